@@ -0,0 +1,83 @@
+// Command encrypt-tokens is a one-shot migration that encrypts the GitHub
+// access tokens still stored in plaintext, and re-encrypts tokens sealed
+// under an older key after TOKEN_ENCRYPTION_KEYS has been rotated.
+//
+// It reads COCKROACHDB_URL and TOKEN_ENCRYPTION_KEYS like the functions do:
+//
+//	go run ./cmd/encrypt-tokens [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/secrets"
+)
+
+type row struct {
+	id     int
+	stored string
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report how many rows would change without writing them")
+	flag.Parse()
+
+	ctx := context.Background()
+	conn, err := db.Connect(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	rows, err := conn.Query(ctx, `SELECT id, access_token FROM users;`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.stored); err != nil {
+			log.Fatal(err)
+		}
+		ok, err := secrets.NeedsRotation(r.stored)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if ok {
+			pending = append(pending, r)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("%d tokens to encrypt", len(pending))
+	if *dryRun {
+		return
+	}
+
+	updated := 0
+	for _, r := range pending {
+		plaintext, err := secrets.Decrypt(r.stored, db.TokenContext(r.id))
+		if err != nil {
+			log.Printf("user %d: %v", r.id, err)
+			continue
+		}
+		sealed, err := secrets.Encrypt(plaintext, db.TokenContext(r.id))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// skip rows a concurrent login rewrote since they were read
+		tag, err := conn.Exec(ctx, `UPDATE users SET access_token = $1 WHERE id = $2 AND access_token = $3;`, sealed, r.id, r.stored)
+		if err != nil {
+			log.Fatal(err)
+		}
+		updated += int(tag.RowsAffected())
+	}
+
+	log.Printf("encrypted %d of %d tokens", updated, len(pending))
+}
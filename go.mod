@@ -4,14 +4,14 @@ go 1.20
 
 require (
 	github.com/aws/aws-lambda-go v1.40.0
+	github.com/golang-jwt/jwt/v5 v5.0.0
 	github.com/golangcollege/sessions v1.2.0
 	github.com/jackc/pgx/v5 v5.3.1
 	golang.org/x/oauth2 v0.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
-	github.com/golang-jwt/jwt/v5 v5.0.0 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
@@ -50,10 +50,35 @@ export const useBulletin = ({
 export type Section = {
   id: string;
   name: string;
-  repos: { id: string; repoID: number }[];
+  description?: string;
+  layout?: "grid" | "list";
+  sort?: "manual" | "stars" | "name";
+  collapsed?: boolean;
+  repos: {
+    id: string;
+    kind?:
+      | "github_repo"
+      | "link"
+      | "gitlab_repo"
+      | "codeberg_repo"
+      | "npm_package"
+      | "go_module"
+      | "gist";
+    repoID?: number;
+    url?: string;
+    title?: string;
+    project?: string;
+    package?: string;
+    module?: string;
+    gistID?: string;
+    blurb?: string;
+    featured?: boolean;
+    status?: "deleted" | "private" | "transferred";
+  }[];
 };
 
 export type Bulletin = {
+  schemaVersion?: number;
   sections: Section[];
 } | null;
 
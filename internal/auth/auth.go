@@ -0,0 +1,151 @@
+// Package auth issues and validates the JWT session cookie shared by the
+// Netlify functions.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// CookieName is the name of the cookie holding the session JWT.
+	CookieName = "jwt"
+
+	// Issuer and Audience are stamped into every token and required on the
+	// way back in, so tokens minted for another service are rejected.
+	Issuer   = "https://repobullet.in"
+	Audience = "repobullet.in"
+
+	// TokenTTL is how long a token (and its cookie) stays valid.
+	TokenTTL = 24 * time.Hour
+
+	// refreshAfter is the age at which WithRefresh reissues a token.
+	refreshAfter = TokenTTL / 2
+)
+
+// Claims is the payload of a session JWT. User is the GitHub user ID, kept
+// as a string "id" claim for compatibility with the original tokens.
+type Claims struct {
+	User string `json:"id"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the GitHub user ID the claims were issued to.
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.User)
+}
+
+// GetUser returns the GitHub user ID stored in the request's JWT cookie,
+// provided its session is still active.
+func GetUser(ctx context.Context, conn db.Querier, request events.APIGatewayProxyRequest) (int, error) {
+	claims, err := GetSession(ctx, conn, request)
+	if err != nil {
+		return 0, err
+	}
+
+	return claims.UserID()
+}
+
+// GenerateJWT starts a new session for the given GitHub user ID and signs a
+// token for it.
+func GenerateJWT(ctx context.Context, conn db.Querier, id int) (string, error) {
+	jti, err := generateJTI()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = createSession(ctx, conn, id, jti, now.Add(TokenTTL))
+	if err != nil {
+		return "", err
+	}
+
+	return sign(fmt.Sprint(id), jti, now)
+}
+
+// SetCookie returns a set-cookie value storing the given JWT.
+func SetCookie(token string) string {
+	return fmt.Sprintf(`%s=%s;Path=/;HttpOnly;Secure;SameSite=strict;max-age=%d`, CookieName, token, int(TokenTTL.Seconds()))
+}
+
+// ClearCookie returns a set-cookie value that expires the JWT cookie.
+func ClearCookie() string {
+	return httpx.ClearCookie(CookieName)
+}
+
+// ParseToken validates a token's signature against the keyset, its expiry,
+// issuer and audience and returns its claims.
+func ParseToken(tokenString string) (*Claims, error) {
+	ks, err := LoadKeyset()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, ks.Keyfunc,
+		jwt.WithIssuer(Issuer),
+		jwt.WithAudience(Audience),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// jwt only checks exp when it is present; tokens without one are from
+	// before expiry was enforced and must not live forever.
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("Token has no expiry.")
+	}
+	if claims.User == "" {
+		return nil, errors.New("Unexpected ID type.")
+	}
+
+	return claims, nil
+}
+
+func getClaims(request events.APIGatewayProxyRequest) (*Claims, error) {
+	tokenString, err := httpx.GetCookie(request, CookieName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseToken(tokenString)
+}
+
+func sign(id, jti string, now time.Time) (string, error) {
+	claims := Claims{
+		User: id,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    Issuer,
+			Audience:  jwt.ClaimStrings{Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(TokenTTL)),
+			ID:        jti,
+		},
+	}
+
+	ks, err := LoadKeyset()
+	if err != nil {
+		return "", err
+	}
+
+	return ks.Sign(claims)
+}
+
+func generateJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// legacyKeyID is the kid given to JWT_SECRET. Tokens issued before key
+// rotation carry no kid header and are verified against it.
+const legacyKeyID = "default"
+
+// Key is a single entry of the keyset. Verify-only keys (e.g. a retired
+// Ed25519 key of which only the public half is kept) have a nil signKey.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// Keyset holds every key a token may be verified with. The first key is the
+// newest and is used for signing.
+type Keyset struct {
+	keys []*Key
+	byID map[string]*Key
+}
+
+var (
+	keysetOnce sync.Once
+	keyset     *Keyset
+	keysetErr  error
+)
+
+// LoadKeyset returns the keyset configured by the environment. It is parsed
+// once per cold start.
+//
+// JWT_KEYS is a comma separated list of kid:alg:key entries, newest first.
+// alg is one of HS256, EdDSA or RS256. For HS256 the key is the base64
+// encoded secret; for EdDSA and RS256 it is a base64 encoded PEM private key,
+// or a public key for entries that are only kept to verify old tokens. If
+// JWT_KEYS is unset, JWT_SECRET is used as a single HS256 key.
+func LoadKeyset() (*Keyset, error) {
+	keysetOnce.Do(func() {
+		keyset, keysetErr = parseKeyset(os.Getenv("JWT_KEYS"), os.Getenv("JWT_SECRET"))
+	})
+	return keyset, keysetErr
+}
+
+func parseKeyset(keys, legacySecret string) (*Keyset, error) {
+	ks := &Keyset{byID: map[string]*Key{}}
+
+	for _, entry := range strings.Split(keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("Malformed JWT_KEYS entry: %q", truncate(entry))
+		}
+
+		key, err := parseKey(parts[0], parts[1], parts[2])
+		if err != nil {
+			return nil, err
+		}
+		if err := ks.add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if legacySecret != "" && ks.byID[legacyKeyID] == nil {
+		legacy := &Key{
+			ID:        legacyKeyID,
+			Method:    jwt.SigningMethodHS256,
+			signKey:   []byte(legacySecret),
+			verifyKey: []byte(legacySecret),
+		}
+		if err := ks.add(legacy); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ks.keys) == 0 {
+		return nil, errors.New("No JWT keys configured.")
+	}
+	if ks.keys[0].signKey == nil {
+		return nil, fmt.Errorf("Newest JWT key %q cannot sign.", ks.keys[0].ID)
+	}
+
+	return ks, nil
+}
+
+func parseKey(id, alg, material string) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("JWT key without kid.")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(material)
+	if err != nil {
+		return nil, fmt.Errorf("JWT key %q is not valid base64.", id)
+	}
+
+	key := &Key{ID: id}
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		key.Method = jwt.SigningMethodHS256
+		key.signKey, key.verifyKey = raw, raw
+
+	case jwt.SigningMethodEdDSA.Alg():
+		key.Method = jwt.SigningMethodEdDSA
+		if priv, err := jwt.ParseEdPrivateKeyFromPEM(raw); err == nil {
+			key.signKey = priv
+			key.verifyKey = priv.(ed25519.PrivateKey).Public()
+		} else if pub, err := jwt.ParseEdPublicKeyFromPEM(raw); err == nil {
+			key.verifyKey = pub
+		} else {
+			return nil, fmt.Errorf("JWT key %q is not an Ed25519 PEM key.", id)
+		}
+
+	case jwt.SigningMethodRS256.Alg():
+		key.Method = jwt.SigningMethodRS256
+		if priv, err := jwt.ParseRSAPrivateKeyFromPEM(raw); err == nil {
+			key.signKey = priv
+			key.verifyKey = &priv.PublicKey
+		} else if pub, err := jwt.ParseRSAPublicKeyFromPEM(raw); err == nil {
+			key.verifyKey = pub
+		} else {
+			return nil, fmt.Errorf("JWT key %q is not an RSA PEM key.", id)
+		}
+
+	default:
+		return nil, fmt.Errorf("JWT key %q has unsupported algorithm %q.", id, alg)
+	}
+
+	return key, nil
+}
+
+func (ks *Keyset) add(key *Key) error {
+	if _, ok := ks.byID[key.ID]; ok {
+		return fmt.Errorf("Duplicate JWT kid %q.", key.ID)
+	}
+	ks.keys = append(ks.keys, key)
+	ks.byID[key.ID] = key
+	return nil
+}
+
+// Sign signs claims with the newest key and stamps its kid in the header.
+func (ks *Keyset) Sign(claims jwt.Claims) (string, error) {
+	key := ks.keys[0]
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// Keyfunc resolves the verification key for a token from its kid header. A
+// token must use the same algorithm as the key it names, so an HS256 token
+// can never be checked against an RSA public key.
+func (ks *Keyset) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKeyID
+	}
+
+	key, ok := ks.byID[kid]
+	if !ok {
+		return nil, fmt.Errorf("Unknown kid: %v", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.verifyKey, nil
+}
+
+// truncate keeps key material out of error messages.
+func truncate(s string) string {
+	if len(s) > 12 {
+		return s[:12] + "..."
+	}
+	return s
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	hmacSecret = []byte("0123456789abcdef0123456789abcdef")
+	edPriv     ed25519.PrivateKey
+	edPrivPEM  string
+	edPubPEM   string
+)
+
+func init() {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	edPriv = priv
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		panic(err)
+	}
+	edPrivPEM = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	der, err = x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		panic(err)
+	}
+	edPubPEM = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestParseKeyset(t *testing.T) {
+	hs := base64.StdEncoding.EncodeToString(hmacSecret)
+
+	tests := []struct {
+		name    string
+		keys    string
+		legacy  string
+		wantIDs []string // nil if parsing must fail
+	}{
+		{name: "single HS256 key", keys: "a:HS256:" + hs, wantIDs: []string{"a"}},
+		{name: "legacy secret only", legacy: "secret", wantIDs: []string{legacyKeyID}},
+		{name: "legacy secret last", keys: "a:HS256:" + hs, legacy: "secret", wantIDs: []string{"a", legacyKeyID}},
+		{name: "legacy secret shadowed by kid default", keys: "default:HS256:" + hs, legacy: "secret", wantIDs: []string{legacyKeyID}},
+		{name: "EdDSA private key", keys: "ed:EdDSA:" + edPrivPEM, wantIDs: []string{"ed"}},
+		{name: "older key verify-only", keys: "a:HS256:" + hs + ", old:EdDSA:" + edPubPEM, wantIDs: []string{"a", "old"}},
+		{name: "newest key verify-only", keys: "old:EdDSA:" + edPubPEM + ",a:HS256:" + hs},
+		{name: "no keys"},
+		{name: "malformed entry", keys: "a:HS256"},
+		{name: "empty kid", keys: ":HS256:" + hs},
+		{name: "duplicate kid", keys: "a:HS256:" + hs + ",a:HS256:" + hs},
+		{name: "unsupported algorithm", keys: "a:HS512:" + hs},
+		{name: "invalid base64", keys: "a:HS256:not base64"},
+		{name: "HS256 material as EdDSA", keys: "a:EdDSA:" + hs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := parseKeyset(tt.keys, tt.legacy)
+			if tt.wantIDs == nil {
+				if err == nil {
+					t.Fatal("keyset parsed, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, k := range ks.keys {
+				ids = append(ids, k.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("kids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestKeyfunc(t *testing.T) {
+	hs := base64.StdEncoding.EncodeToString(hmacSecret)
+	ks, err := parseKeyset("hs:HS256:"+hs+",ed:EdDSA:"+edPrivPEM+",old:EdDSA:"+edPubPEM, "legacy-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "1"})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{name: "HS256 key", token: sign(jwt.SigningMethodHS256, "hs", hmacSecret), valid: true},
+		{name: "EdDSA key", token: sign(jwt.SigningMethodEdDSA, "ed", edPriv), valid: true},
+		{name: "verify-only key", token: sign(jwt.SigningMethodEdDSA, "old", edPriv), valid: true},
+		{name: "legacy token without kid", token: sign(jwt.SigningMethodHS256, "", []byte("legacy-secret")), valid: true},
+		{name: "legacy token with wrong secret", token: sign(jwt.SigningMethodHS256, "", hmacSecret)},
+		{name: "legacy token with other alg", token: sign(jwt.SigningMethodEdDSA, "", edPriv)},
+		{name: "EdDSA token naming HS256 key", token: sign(jwt.SigningMethodEdDSA, "hs", edPriv)},
+		{name: "HS256 token naming EdDSA key", token: sign(jwt.SigningMethodHS256, "ed", hmacSecret)},
+		{name: "unknown kid", token: sign(jwt.SigningMethodHS256, "gone", hmacSecret)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, ks.Keyfunc)
+			if tt.valid && err != nil {
+				t.Errorf("err = %v, want valid", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("token verified, want an error")
+			}
+		})
+	}
+}
+
+func TestSignUsesNewestKey(t *testing.T) {
+	hs := base64.StdEncoding.EncodeToString(hmacSecret)
+	ks, err := parseKeyset("ed:EdDSA:"+edPrivPEM+",hs:HS256:"+hs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ks.Sign(jwt.MapClaims{"sub": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Parse(s, ks.Keyfunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := token.Header["kid"]; kid != "ed" {
+		t.Errorf("kid = %v, want ed", kid)
+	}
+	if alg := token.Method.Alg(); alg != jwt.SigningMethodEdDSA.Alg() {
+		t.Errorf("alg = %v, want EdDSA", alg)
+	}
+}
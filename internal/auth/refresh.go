@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler is the signature shared by the Netlify function handlers.
+type Handler func(events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error)
+
+// WithRefresh wraps h with a sliding session: when a request succeeds with a
+// token older than half its lifetime, the session is extended and the
+// response reissues the cookie with a fresh expiry, so active users are not
+// logged out mid-edit.
+func WithRefresh(h Handler) Handler {
+	return func(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+		resp, err := h(request)
+		if err != nil || resp == nil || resp.StatusCode >= http.StatusBadRequest || setsCookie(resp) {
+			return resp, err
+		}
+
+		claims, err := getClaims(request)
+		if err != nil || time.Since(claims.IssuedAt.Time) < refreshAfter {
+			return resp, nil
+		}
+
+		// the current token is still valid, so on any failure below just
+		// leave it be and try again on the next request
+		token, ok := refresh(claims)
+		if !ok {
+			return resp, nil
+		}
+
+		if resp.MultiValueHeaders == nil {
+			resp.MultiValueHeaders = map[string][]string{}
+		}
+		resp.MultiValueHeaders["set-cookie"] = append(resp.MultiValueHeaders["set-cookie"], SetCookie(token))
+		return resp, nil
+	}
+}
+
+func refresh(claims *Claims) (string, bool) {
+	ctx := context.Background()
+	conn, err := db.Connect(ctx)
+	if err != nil {
+		return "", false
+	}
+	defer conn.Close(ctx)
+
+	now := time.Now()
+	ok, err := extendSession(ctx, conn, claims.ID, now.Add(TokenTTL))
+	if err != nil || !ok {
+		return "", false
+	}
+
+	token, err := sign(claims.User, claims.ID, now)
+	if err != nil {
+		return "", false
+	}
+	return token, true
+}
+
+// setsCookie reports whether the handler already set a cookie, e.g. when
+// logging out, in which case the refresh must not override it.
+func setsCookie(resp *events.APIGatewayProxyResponse) bool {
+	for k := range resp.Headers {
+		if http.CanonicalHeaderKey(k) == "Set-Cookie" {
+			return true
+		}
+	}
+	for k := range resp.MultiValueHeaders {
+		if http.CanonicalHeaderKey(k) == "Set-Cookie" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetSession returns the claims of the request's JWT after checking that its
+// session is still active.
+func GetSession(ctx context.Context, conn db.Querier, request events.APIGatewayProxyRequest) (*Claims, error) {
+	claims, err := getClaims(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var active bool
+	row := conn.QueryRow(ctx, `SELECT revoked_at IS NULL AND expires_at > now() FROM sessions WHERE jti = $1;`, claims.ID)
+	err = row.Scan(&active)
+	if err == pgx.ErrNoRows {
+		return nil, errors.New("Session does not exist.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, errors.New("Session is no longer active.")
+	}
+
+	return claims, nil
+}
+
+// Revoke ends the session with the given jti.
+func Revoke(ctx context.Context, conn db.Querier, jti string) error {
+	_, err := conn.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE jti = $1 AND revoked_at IS NULL;`, jti)
+	return err
+}
+
+// RevokeAll ends every session belonging to the user, logging them out on
+// all devices.
+func RevokeAll(ctx context.Context, conn db.Querier, userID int) error {
+	_, err := conn.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL;`, userID)
+	return err
+}
+
+func createSession(ctx context.Context, conn db.Querier, userID int, jti string, expiresAt time.Time) error {
+	_, err := conn.Exec(ctx, `INSERT INTO sessions (jti, user_id, expires_at) VALUES ($1, $2, $3);`, jti, userID, expiresAt)
+	return err
+}
+
+// extendSession moves an active session's expiry forward. It reports false
+// if the session was revoked or has already expired.
+func extendSession(ctx context.Context, conn db.Querier, jti string, expiresAt time.Time) (bool, error) {
+	tag, err := conn.Exec(ctx, `UPDATE sessions SET expires_at = $1 WHERE jti = $2 AND revoked_at IS NULL AND expires_at > now();`, expiresAt, jti)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// ShareAudience is the audience of share tokens. It differs from
+	// Audience, so a share token is never accepted as a session.
+	ShareAudience = "repobullet.in/share"
+
+	// MaxShareTTL is the longest a share token may stay valid.
+	MaxShareTTL = 30 * 24 * time.Hour
+)
+
+// ShareClaims is the payload of a share token, which grants read access to
+// one private bulletin. Subject is the owner's GitHub user ID, and Key the
+// bulletin's share key when the token was signed.
+type ShareClaims struct {
+	Slug string `json:"slug"`
+	Key  string `json:"key"`
+	jwt.RegisteredClaims
+}
+
+// SignShareToken signs a token granting read access to the user's bulletin
+// with the given slug and share key until expiresAt.
+func SignShareToken(userID int, slug, key string, expiresAt time.Time) (string, error) {
+	jti, err := generateJTI()
+	if err != nil {
+		return "", err
+	}
+
+	claims := ShareClaims{
+		Slug: slug,
+		Key:  key,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    Issuer,
+			Audience:  jwt.ClaimStrings{ShareAudience},
+			Subject:   strconv.Itoa(userID),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        jti,
+		},
+	}
+
+	ks, err := LoadKeyset()
+	if err != nil {
+		return "", err
+	}
+
+	return ks.Sign(claims)
+}
+
+// CheckShareToken reports whether token is a valid, unexpired share token
+// for the user's bulletin with the given slug and its current share key.
+func CheckShareToken(token string, userID int, slug, key string) bool {
+	claims, err := parseShareToken(token)
+	if err != nil {
+		return false
+	}
+	return claims.Subject == strconv.Itoa(userID) && claims.Slug == slug && claims.Key == key
+}
+
+func parseShareToken(tokenString string) (*ShareClaims, error) {
+	ks, err := LoadKeyset()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &ShareClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, ks.Keyfunc,
+		jwt.WithIssuer(Issuer),
+		jwt.WithAudience(ShareAudience),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("Token has no expiry.")
+	}
+	if claims.Slug == "" {
+		return nil, errors.New("Share token has no slug.")
+	}
+	if claims.Key == "" {
+		return nil, errors.New("Share token has no key.")
+	}
+
+	return claims, nil
+}
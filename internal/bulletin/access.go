@@ -0,0 +1,268 @@
+package bulletin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/external"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/BoilingSoup/repo-bulletin/internal/repocache"
+)
+
+// ErrGitHub is returned by CheckRepoAccess when GitHub could not be asked.
+var ErrGitHub = errors.New("Failed to request user repos.")
+
+// Access modes, a user setting deciding which repos they may pin.
+const (
+	// AccessOwned allows repos the user owns or that belong to one of their
+	// organizations. It is the default.
+	AccessOwned = "owned"
+	// AccessAffiliated also allows repos the user is a collaborator on.
+	AccessAffiliated = "affiliated"
+	// AccessContributed also allows repos the user contributed to in the
+	// past year, as counted by GitHub.
+	AccessContributed = "contributed"
+)
+
+// ValidAccess reports whether mode is a known access mode.
+func ValidAccess(mode string) bool {
+	switch mode {
+	case AccessOwned, AccessAffiliated, AccessContributed:
+		return true
+	}
+	return false
+}
+
+// CheckRepoAccess reports a violation for every GitHub repo the user may
+// not pin under their access mode, and records the Relationship of the
+// user to every repo they may. Repos the cache freshly knows the user owns
+// are accepted without calling GitHub; only if some remain are the user's
+// repos listed, and the pinned repos found in the listing are written to
+// the cache. If the listing is too long to follow to the end, pinned repos
+// missing from it are looked up one by one.
+func CheckRepoAccess(ctx context.Context, conn db.Querier, user *db.User, p Payload) ([]Violation, error) {
+	ids := p.RepoIDs()
+
+	cached, err := repocache.Fresh(ctx, conn, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	related := map[int]string{}
+	unresolved := false
+	for _, id := range ids {
+		if meta, ok := cached[id]; ok && meta.OwnerID == user.ID {
+			related[id] = RelationshipOwner
+		} else {
+			unresolved = true
+		}
+	}
+
+	if unresolved {
+		listed, err := pinnableRepos(ctx, user)
+		truncated := err == github.ErrTruncated
+		if err != nil && !truncated {
+			return nil, ErrGitHub
+		}
+		// A truncated list of contributions is used as it is, as there is
+		// no asking GitHub about a single repo.
+		var contributed []int
+		if user.RepoAccess == AccessContributed {
+			contributed, err = github.NewClient(user.AccessToken).ContributedRepos(ctx)
+			if err != nil && err != github.ErrTruncated {
+				return nil, ErrGitHub
+			}
+		}
+
+		pinned := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			pinned[id] = true
+		}
+		for i := range listed {
+			repo := &listed[i]
+			related[repo.ID] = relationship(user, repo)
+			if pinned[repo.ID] {
+				err := repocache.Store(ctx, conn, repocache.FromGitHub(repo))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, id := range contributed {
+			if _, ok := related[id]; !ok {
+				related[id] = RelationshipContributor
+			}
+		}
+
+		if truncated {
+			for _, id := range ids {
+				if _, ok := related[id]; ok {
+					continue
+				}
+				repo, err := pinnableRepo(ctx, user, id)
+				if err != nil {
+					return nil, err
+				}
+				if repo == nil {
+					continue
+				}
+				related[id] = relationship(user, repo)
+				err = repocache.Store(ctx, conn, repocache.FromGitHub(repo))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var violations []Violation
+	for i, section := range p.Sections {
+		for j := range section.Repos {
+			repo := &section.Repos[j]
+			if !repo.IsGitHubRepo() {
+				continue
+			}
+			r, ok := related[repo.RepoID]
+			if !ok {
+				violations = append(violations, Violation{
+					Path:    fmt.Sprintf("/sections/%d/repos/%d/repoID", i, j),
+					Message: "repo is not one the user may pin",
+				})
+				continue
+			}
+			repo.Relationship = r
+		}
+	}
+	return violations, nil
+}
+
+// CheckGistAccess reports a violation for every gist that is not one of
+// the user's public gists. Gists are listed with the user's token only if
+// the payload has any, and the pinned ones found are written to the cache.
+// As with repos, pinned gists missing from a truncated listing are looked
+// up one by one.
+func CheckGistAccess(ctx context.Context, conn db.Querier, user *db.User, p Payload) ([]Violation, error) {
+	pinned := map[string]bool{}
+	for _, section := range p.Sections {
+		for _, e := range section.Repos {
+			if e.Kind == KindGist {
+				pinned[e.GistID] = true
+			}
+		}
+	}
+	if len(pinned) == 0 {
+		return nil, nil
+	}
+
+	client := github.NewClient(user.AccessToken)
+	gists, err := client.ListGists(ctx)
+	if err == github.ErrTruncated {
+		listed := map[string]bool{}
+		for i := range gists {
+			listed[gists[i].ID] = true
+		}
+		for id := range pinned {
+			if listed[id] {
+				continue
+			}
+			g, err := client.Gist(ctx, id)
+			if github.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, ErrGitHub
+			}
+			if g.Owner.ID == user.ID {
+				gists = append(gists, *g)
+			}
+		}
+	} else if err != nil {
+		return nil, ErrGitHub
+	}
+	valid := map[string]bool{}
+	for i := range gists {
+		g := &gists[i]
+		if !g.Public || !pinned[g.ID] {
+			continue
+		}
+		valid[g.ID] = true
+		err := external.Store(ctx, conn, external.Ref{Source: external.Gist, Key: g.ID}, external.FromGist(g))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var violations []Violation
+	for i, section := range p.Sections {
+		for j, e := range section.Repos {
+			if e.Kind == KindGist && !valid[e.GistID] {
+				violations = append(violations, Violation{
+					Path:    fmt.Sprintf("/sections/%d/repos/%d/gistID", i, j),
+					Message: "gist is not one of the user's public gists",
+				})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// pinnableRepos lists the public repos the user is affiliated with that
+// they may pin under their access mode. Contributions are not included.
+func pinnableRepos(ctx context.Context, user *db.User) ([]github.Repo, error) {
+	affiliations := []string{github.AffiliationOwner, github.AffiliationOrganizationMember}
+	if user.RepoAccess == AccessAffiliated || user.RepoAccess == AccessContributed {
+		affiliations = append(affiliations, github.AffiliationCollaborator)
+	}
+	return github.NewClient(user.AccessToken).ListRepos(ctx, affiliations...)
+}
+
+// pinnableRepo looks up a single repo the user's listing did not reach,
+// returning nil if it is not a public repo they may pin under their access
+// mode. Contributions are not considered.
+func pinnableRepo(ctx context.Context, user *db.User, id int) (*github.Repo, error) {
+	client := github.NewClient(user.AccessToken)
+	repo, err := client.Repo(ctx, id)
+	if github.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrGitHub
+	}
+
+	switch {
+	case repo.Private:
+		return nil, nil
+	case repo.Owner.ID == user.ID:
+		return repo, nil
+	case repo.Owner.Type == "Organization":
+		m, err := client.Membership(ctx, repo.Owner.Login)
+		if err != nil && !github.IsNotFound(err) {
+			return nil, ErrGitHub
+		}
+		if err == nil && m.State == "active" {
+			return repo, nil
+		}
+	}
+	if user.RepoAccess == AccessAffiliated || user.RepoAccess == AccessContributed {
+		if repo.Permissions.Push {
+			return repo, nil
+		}
+	}
+	return nil, nil
+}
+
+// relationship is the user's relationship to a repo from their listing. A
+// listing does not say why a repo is in it, so a collaborator on an
+// organization's repo counts as a member.
+func relationship(user *db.User, repo *github.Repo) string {
+	switch {
+	case repo.Owner.ID == user.ID:
+		return RelationshipOwner
+	case repo.Owner.Type == "Organization":
+		return RelationshipMember
+	default:
+		return RelationshipCollaborator
+	}
+}
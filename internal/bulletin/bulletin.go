@@ -0,0 +1,163 @@
+// Package bulletin defines the bulletin document saved by users and the
+// rules it must satisfy.
+package bulletin
+
+/*
+	{
+	  schemaVersion: 4,
+	  sections: [
+	    {
+	      id: nanoid(),
+	      name: "my title blahblahblah",
+	      description?: "markdown",
+	      layout?: "grid" | "list",
+	      sort?: "manual" | "stars" | "name",
+	      collapsed?: boolean,
+	      repos: [
+	        {
+	          id: nanoid(),
+	          kind?: "github_repo" | "link" | "gitlab_repo" | "codeberg_repo" | "npm_package" | "go_module" | "gist",
+	          repoID: number,          // github_repo
+	          url?: string,            // link
+	          title?: string,          // link
+	          project?: "group/name",  // gitlab_repo, codeberg_repo
+	          package?: string,        // npm_package
+	          module?: string,         // go_module
+	          gistID?: string,         // gist
+	          blurb?: "shown instead of the description",
+	          featured?: boolean
+	        }
+	      ]
+	    }
+	  ]
+	}
+
+	Fields marked ? were added in schema version 2, kind with its fields in
+	version 3 and gists in version 4. Payloads without a schemaVersion are
+	version 1, which is still accepted; saves store the current version.
+	Entries are still under "repos", and entries without a kind are GitHub
+	repos. /export and /import use the same document, see Export.
+*/
+
+// SchemaVersion is the current version of the payload schema.
+const SchemaVersion = 4
+
+// Entry kinds.
+const (
+	KindGitHubRepo   = "github_repo"
+	KindLink         = "link"
+	KindGitLabRepo   = "gitlab_repo"
+	KindCodebergRepo = "codeberg_repo"
+	KindNPMPackage   = "npm_package"
+	KindGoModule     = "go_module"
+	KindGist         = "gist"
+)
+
+// Entry is one item of a section. Which fields are set depends on Kind.
+type Entry struct {
+	Id      string `json:"id"`
+	Kind    string `json:"kind,omitempty"`
+	RepoID  int    `json:"repoID,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Project string `json:"project,omitempty"`
+	Package string `json:"package,omitempty"`
+	Module  string `json:"module,omitempty"`
+	GistID  string `json:"gistID,omitempty"`
+	// Blurb is plain text shown instead of the entry's description.
+	Blurb    string `json:"blurb,omitempty"`
+	Featured bool   `json:"featured,omitempty"`
+	// Relationship is how the user came to be allowed to pin the repo. It
+	// is set on save; whatever the client sends is replaced.
+	Relationship string `json:"relationship,omitempty"`
+	// Status is set by the reconcile-bulletins job when the repo can no
+	// longer be shown; it is empty for healthy repos and ignored on save.
+	Status string `json:"status,omitempty"`
+}
+
+// Relationships of a user to a pinned repo.
+const (
+	RelationshipOwner        = "owner"
+	RelationshipMember       = "member"
+	RelationshipCollaborator = "collaborator"
+	RelationshipContributor  = "contributor"
+)
+
+// Repo statuses set by reconciliation.
+const (
+	RepoDeleted     = "deleted"
+	RepoPrivate     = "private"
+	RepoTransferred = "transferred"
+)
+
+type Section struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// Description is Markdown, rendered by the client.
+	Description string `json:"description,omitempty"`
+	Layout      string `json:"layout,omitempty"`
+	Sort        string `json:"sort,omitempty"`
+	Collapsed   bool   `json:"collapsed,omitempty"`
+	// Repos holds entries of any kind; it keeps its name from when it
+	// could only hold GitHub repos.
+	Repos []Entry `json:"repos"`
+}
+
+// Section layouts; empty means LayoutGrid.
+const (
+	LayoutGrid = "grid"
+	LayoutList = "list"
+)
+
+// Section sort orders; empty means SortManual, the order of Repos.
+// Featured repos come first whatever the order.
+const (
+	SortManual = "manual"
+	SortStars  = "stars"
+	SortName   = "name"
+)
+
+type Payload struct {
+	SchemaVersion int       `json:"schemaVersion,omitempty"`
+	Sections      []Section `json:"sections"`
+}
+
+const (
+	MaxSections                 = 50
+	MaxSectionNameLength        = 100
+	MaxSectionDescriptionLength = 2000
+	MaxReposPerSection          = 100
+	MaxBlurbLength              = 300
+	MaxURLLength                = 2000
+	MaxEntryTitleLength         = 100
+	MaxEntryNameLength          = 214
+)
+
+// IsGitHubRepo reports whether the entry is a GitHub repo, which entries
+// without a kind are.
+func (e Entry) IsGitHubRepo() bool {
+	return e.Kind == "" || e.Kind == KindGitHubRepo
+}
+
+// RepoIDs returns every GitHub repository ID pinned in the payload.
+func (p Payload) RepoIDs() []int {
+	var ids []int
+	for _, section := range p.Sections {
+		for _, repo := range section.Repos {
+			if repo.IsGitHubRepo() {
+				ids = append(ids, repo.RepoID)
+			}
+		}
+	}
+	return ids
+}
+
+// ClearStatuses drops client supplied repo statuses; only reconciliation
+// may set them.
+func (p Payload) ClearStatuses() {
+	for i := range p.Sections {
+		for j := range p.Sections[i].Repos {
+			p.Sections[i].Repos[j].Status = ""
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package bulletin
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Change is one difference between two payloads. Sections and repos are
+// matched by their client generated ids, so a dragged repo shows up as a
+// move rather than a removal plus an addition. Path points into the newer
+// payload, or into the older one for removals. An update is a change to
+// one of the other fields of a section or repo, e.g. its description or
+// blurb, with From and To holding the old and new value.
+type Change struct {
+	Op      string `json:"op"` // add, remove, rename, move or update
+	Path    string `json:"path"`
+	Section string `json:"section"`
+	Repo    string `json:"repo,omitempty"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+}
+
+type repoPosition struct {
+	section string
+	index   int
+	path    string
+	entry   Entry
+}
+
+// field is a field of a section or entry compared by Diff, as text.
+type field struct {
+	name, from, to string
+}
+
+// sectionFields lists the fields of a section besides its name, which is
+// reported as a rename, and its repos.
+func sectionFields(s Section) []field {
+	return []field{
+		{name: "description", to: s.Description},
+		{name: "layout", to: s.Layout},
+		{name: "sort", to: s.Sort},
+		{name: "collapsed", to: strconv.FormatBool(s.Collapsed)},
+	}
+}
+
+// entryFields lists the fields of an entry set by the client.
+func entryFields(e Entry) []field {
+	repoID := ""
+	if e.RepoID != 0 {
+		repoID = strconv.Itoa(e.RepoID)
+	}
+	return []field{
+		{name: "kind", to: e.Kind},
+		{name: "repoID", to: repoID},
+		{name: "url", to: e.URL},
+		{name: "title", to: e.Title},
+		{name: "project", to: e.Project},
+		{name: "package", to: e.Package},
+		{name: "module", to: e.Module},
+		{name: "gistID", to: e.GistID},
+		{name: "blurb", to: e.Blurb},
+		{name: "featured", to: strconv.FormatBool(e.Featured)},
+		{name: "status", to: e.Status},
+	}
+}
+
+// updatedFields pairs up the fields of an old and a new section or entry
+// and returns those that differ.
+func updatedFields(from, to []field) []field {
+	var updated []field
+	for i := range to {
+		if from[i].to != to[i].to {
+			updated = append(updated, field{name: to[i].name, from: from[i].to, to: to[i].to})
+		}
+	}
+	return updated
+}
+
+// Diff lists the changes that turn from into to.
+func Diff(from, to Payload) []Change {
+	changes := []Change{}
+
+	fromSections := map[string]int{}
+	for i, s := range from.Sections {
+		fromSections[s.Id] = i
+	}
+	toSections := map[string]int{}
+	for i, s := range to.Sections {
+		toSections[s.Id] = i
+	}
+
+	for i, s := range from.Sections {
+		if _, ok := toSections[s.Id]; !ok {
+			changes = append(changes, Change{Op: "remove", Path: sectionPath(i), Section: s.Id, From: s.Name})
+		}
+	}
+	for i, s := range to.Sections {
+		j, ok := fromSections[s.Id]
+		if !ok {
+			changes = append(changes, Change{Op: "add", Path: sectionPath(i), Section: s.Id, To: s.Name})
+			continue
+		}
+		if old := from.Sections[j]; old.Name != s.Name {
+			changes = append(changes, Change{Op: "rename", Path: sectionPath(i) + "/name", Section: s.Id, From: old.Name, To: s.Name})
+		}
+		if i != j {
+			changes = append(changes, Change{Op: "move", Path: sectionPath(i), Section: s.Id, From: sectionPath(j), To: sectionPath(i)})
+		}
+		for _, f := range updatedFields(sectionFields(from.Sections[j]), sectionFields(s)) {
+			changes = append(changes, Change{Op: "update", Path: sectionPath(i) + "/" + f.name, Section: s.Id, From: f.from, To: f.to})
+		}
+	}
+
+	fromRepos := repoPositions(from)
+	toRepos := repoPositions(to)
+	for i, s := range from.Sections {
+		for j, r := range s.Repos {
+			if _, ok := toRepos[r.Id]; !ok {
+				changes = append(changes, Change{Op: "remove", Path: repoPath(i, j), Section: s.Id, Repo: r.Id})
+			}
+		}
+	}
+	for i, s := range to.Sections {
+		for j, r := range s.Repos {
+			old, ok := fromRepos[r.Id]
+			if !ok {
+				changes = append(changes, Change{Op: "add", Path: repoPath(i, j), Section: s.Id, Repo: r.Id})
+				continue
+			}
+			// moving a whole section is reported once, not for every repo in it
+			if old.section != s.Id || old.index != j {
+				changes = append(changes, Change{Op: "move", Path: repoPath(i, j), Section: s.Id, Repo: r.Id, From: old.path, To: repoPath(i, j)})
+			}
+			for _, f := range updatedFields(entryFields(old.entry), entryFields(r)) {
+				changes = append(changes, Change{Op: "update", Path: repoPath(i, j) + "/" + f.name, Section: s.Id, Repo: r.Id, From: f.from, To: f.to})
+			}
+		}
+	}
+
+	return changes
+}
+
+func repoPositions(p Payload) map[string]repoPosition {
+	positions := map[string]repoPosition{}
+	for i, s := range p.Sections {
+		for j, r := range s.Repos {
+			positions[r.Id] = repoPosition{section: s.Id, index: j, path: repoPath(i, j), entry: r}
+		}
+	}
+	return positions
+}
+
+func sectionPath(i int) string {
+	return fmt.Sprintf("/sections/%d", i)
+}
+
+func repoPath(i, j int) string {
+	return fmt.Sprintf("/sections/%d/repos/%d", i, j)
+}
@@ -0,0 +1,152 @@
+package bulletin
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// payload decodes a payload written as JSON, for tests.
+func payload(t *testing.T, s string) Payload {
+	t.Helper()
+	var p Payload
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDiff(t *testing.T) {
+	const base = `{"sections": [
+		{"id": "a", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}, {"id": "r2", "repoID": 2}]},
+		{"id": "b", "name": "Talks", "repos": [{"id": "r3", "repoID": 3}]}
+	]}`
+
+	tests := []struct {
+		name string
+		to   string
+		want []Change
+	}{
+		{name: "unchanged", to: base, want: []Change{}},
+		{
+			name: "section added",
+			to: `{"sections": [
+				{"id": "a", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}, {"id": "r2", "repoID": 2}]},
+				{"id": "b", "name": "Talks", "repos": [{"id": "r3", "repoID": 3}]},
+				{"id": "c", "name": "New", "repos": [{"id": "r4", "repoID": 4}]}
+			]}`,
+			want: []Change{
+				{Op: "add", Path: "/sections/2", Section: "c", To: "New"},
+				{Op: "add", Path: "/sections/2/repos/0", Section: "c", Repo: "r4"},
+			},
+		},
+		{
+			name: "section removed",
+			to:   `{"sections": [{"id": "a", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}, {"id": "r2", "repoID": 2}]}]}`,
+			want: []Change{
+				{Op: "remove", Path: "/sections/1", Section: "b", From: "Talks"},
+				{Op: "remove", Path: "/sections/1/repos/0", Section: "b", Repo: "r3"},
+			},
+		},
+		{
+			name: "section renamed",
+			to: `{"sections": [
+				{"id": "a", "name": "Libraries", "repos": [{"id": "r1", "repoID": 1}, {"id": "r2", "repoID": 2}]},
+				{"id": "b", "name": "Talks", "repos": [{"id": "r3", "repoID": 3}]}
+			]}`,
+			want: []Change{{Op: "rename", Path: "/sections/0/name", Section: "a", From: "Tools", To: "Libraries"}},
+		},
+		{
+			name: "sections swapped",
+			to: `{"sections": [
+				{"id": "b", "name": "Talks", "repos": [{"id": "r3", "repoID": 3}]},
+				{"id": "a", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}, {"id": "r2", "repoID": 2}]}
+			]}`,
+			// the repos move with their section and are not reported
+			want: []Change{
+				{Op: "move", Path: "/sections/0", Section: "b", From: "/sections/1", To: "/sections/0"},
+				{Op: "move", Path: "/sections/1", Section: "a", From: "/sections/0", To: "/sections/1"},
+			},
+		},
+		{
+			name: "repo dragged to another section",
+			to: `{"sections": [
+				{"id": "a", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}]},
+				{"id": "b", "name": "Talks", "repos": [{"id": "r2", "repoID": 2}, {"id": "r3", "repoID": 3}]}
+			]}`,
+			want: []Change{
+				{Op: "move", Path: "/sections/1/repos/0", Section: "b", Repo: "r2", From: "/sections/0/repos/1", To: "/sections/1/repos/0"},
+				{Op: "move", Path: "/sections/1/repos/1", Section: "b", Repo: "r3", From: "/sections/1/repos/0", To: "/sections/1/repos/1"},
+			},
+		},
+		{
+			name: "repo replaced",
+			to: `{"sections": [
+				{"id": "a", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}, {"id": "r5", "repoID": 5}]},
+				{"id": "b", "name": "Talks", "repos": [{"id": "r3", "repoID": 3}]}
+			]}`,
+			want: []Change{
+				{Op: "remove", Path: "/sections/0/repos/1", Section: "a", Repo: "r2"},
+				{Op: "add", Path: "/sections/0/repos/1", Section: "a", Repo: "r5"},
+			},
+		},
+		{
+			name: "section fields updated",
+			to: `{"sections": [
+				{"id": "a", "name": "Tools", "description": "CLIs", "layout": "list", "sort": "stars", "collapsed": true,
+				 "repos": [{"id": "r1", "repoID": 1}, {"id": "r2", "repoID": 2}]},
+				{"id": "b", "name": "Talks", "repos": [{"id": "r3", "repoID": 3}]}
+			]}`,
+			want: []Change{
+				{Op: "update", Path: "/sections/0/description", Section: "a", To: "CLIs"},
+				{Op: "update", Path: "/sections/0/layout", Section: "a", To: "list"},
+				{Op: "update", Path: "/sections/0/sort", Section: "a", To: "stars"},
+				{Op: "update", Path: "/sections/0/collapsed", Section: "a", From: "false", To: "true"},
+			},
+		},
+		{
+			name: "repo blurb and featured updated",
+			to: `{"sections": [
+				{"id": "a", "name": "Tools", "repos": [{"id": "r1", "repoID": 1, "blurb": "Fast", "featured": true}, {"id": "r2", "repoID": 2}]},
+				{"id": "b", "name": "Talks", "repos": [{"id": "r3", "repoID": 3}]}
+			]}`,
+			want: []Change{
+				{Op: "update", Path: "/sections/0/repos/0/blurb", Section: "a", Repo: "r1", To: "Fast"},
+				{Op: "update", Path: "/sections/0/repos/0/featured", Section: "a", Repo: "r1", From: "false", To: "true"},
+			},
+		},
+		{
+			name: "entry changed kind",
+			to: `{"sections": [
+				{"id": "a", "name": "Tools", "repos": [{"id": "r1", "kind": "link", "url": "https://example.com", "title": "Example"}, {"id": "r2", "repoID": 2}]},
+				{"id": "b", "name": "Talks", "repos": [{"id": "r3", "repoID": 3}]}
+			]}`,
+			want: []Change{
+				{Op: "update", Path: "/sections/0/repos/0/kind", Section: "a", Repo: "r1", To: "link"},
+				{Op: "update", Path: "/sections/0/repos/0/repoID", Section: "a", Repo: "r1", From: "1"},
+				{Op: "update", Path: "/sections/0/repos/0/url", Section: "a", Repo: "r1", To: "https://example.com"},
+				{Op: "update", Path: "/sections/0/repos/0/title", Section: "a", Repo: "r1", To: "Example"},
+			},
+		},
+		{
+			name: "moved and updated",
+			to: `{"sections": [
+				{"id": "a", "name": "Tools", "repos": [{"id": "r2", "repoID": 2}, {"id": "r1", "repoID": 1, "status": "deleted"}]},
+				{"id": "b", "name": "Talks", "repos": [{"id": "r3", "repoID": 3}]}
+			]}`,
+			want: []Change{
+				{Op: "move", Path: "/sections/0/repos/0", Section: "a", Repo: "r2", From: "/sections/0/repos/1", To: "/sections/0/repos/0"},
+				{Op: "move", Path: "/sections/0/repos/1", Section: "a", Repo: "r1", From: "/sections/0/repos/0", To: "/sections/0/repos/1"},
+				{Op: "update", Path: "/sections/0/repos/1/status", Section: "a", Repo: "r1", To: "deleted"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(payload(t, base), payload(t, tt.to))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package bulletin
+
+import (
+	"context"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/external"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/BoilingSoup/repo-bulletin/internal/repocache"
+)
+
+// ExpandedEntry is an entry along with its metadata. GitHub repos have
+// Metadata and entries hosted elsewhere External, either left out if it
+// could not be resolved. Links have neither, as they carry their own title.
+type ExpandedEntry struct {
+	Entry
+	Metadata *repocache.Metadata `json:"repo,omitempty"`
+	External *external.Metadata  `json:"external,omitempty"`
+}
+
+// ExpandedSection is a Section whose Repos are expanded.
+type ExpandedSection struct {
+	Section
+	Repos []ExpandedEntry `json:"repos"`
+}
+
+type ExpandedPayload struct {
+	SchemaVersion int               `json:"schemaVersion,omitempty"`
+	Sections      []ExpandedSection `json:"sections"`
+}
+
+// Expand resolves each entry to its metadata, through the caches.
+func Expand(ctx context.Context, conn db.Querier, p Payload) (*ExpandedPayload, error) {
+	meta, err := repocache.Lookup(ctx, conn, github.NewAppClient(), p.RepoIDs())
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []external.Ref
+	for _, section := range p.Sections {
+		for _, entry := range section.Repos {
+			if ref, ok := entry.externalRef(); ok {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	ext, err := external.Lookup(ctx, conn, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := ExpandedPayload{SchemaVersion: p.SchemaVersion, Sections: make([]ExpandedSection, len(p.Sections))}
+	for i, section := range p.Sections {
+		entries := make([]ExpandedEntry, len(section.Repos))
+		for j, entry := range section.Repos {
+			entries[j] = ExpandedEntry{Entry: entry}
+			if entry.IsGitHubRepo() {
+				entries[j].Metadata = meta[entry.RepoID]
+			} else if ref, ok := entry.externalRef(); ok {
+				entries[j].External = ext[ref]
+			}
+		}
+		expanded.Sections[i] = ExpandedSection{Section: section, Repos: entries}
+	}
+	return &expanded, nil
+}
+
+// externalRef names the entry at the source it is hosted on, if it is
+// hosted outside GitHub.
+func (e Entry) externalRef() (external.Ref, bool) {
+	switch e.Kind {
+	case KindGitLabRepo:
+		return external.Ref{Source: external.GitLab, Key: e.Project}, true
+	case KindCodebergRepo:
+		return external.Ref{Source: external.Codeberg, Key: e.Project}, true
+	case KindNPMPackage:
+		return external.Ref{Source: external.NPM, Key: e.Package}, true
+	case KindGoModule:
+		return external.Ref{Source: external.Go, Key: e.Module}, true
+	case KindGist:
+		return external.Ref{Source: external.Gist, Key: e.GistID}, true
+	}
+	return external.Ref{}, false
+}
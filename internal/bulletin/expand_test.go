@@ -0,0 +1,60 @@
+package bulletin
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/external"
+	"github.com/BoilingSoup/repo-bulletin/internal/repocache"
+)
+
+func TestExpandedEntryFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry ExpandedEntry
+		want  []string
+	}{
+		{
+			name:  "link",
+			entry: ExpandedEntry{Entry: Entry{Id: "r1", Kind: KindLink, URL: "https://example.com", Title: "Example"}},
+			want:  []string{"id", "kind", "title", "url"},
+		},
+		{
+			name:  "unresolved GitHub repo",
+			entry: ExpandedEntry{Entry: Entry{Id: "r1", RepoID: 1}},
+			want:  []string{"id", "repoID"},
+		},
+		{
+			name:  "GitHub repo",
+			entry: ExpandedEntry{Entry: Entry{Id: "r1", RepoID: 1}, Metadata: &repocache.Metadata{ID: 1}},
+			want:  []string{"id", "repo", "repoID"},
+		},
+		{
+			name:  "npm package",
+			entry: ExpandedEntry{Entry: Entry{Id: "r1", Kind: KindNPMPackage, Package: "left-pad"}, External: &external.Metadata{Name: "left-pad"}},
+			want:  []string{"external", "id", "kind", "package"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]any
+			if err := json.Unmarshal(b, &fields); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for k := range fields {
+				got = append(got, k)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package bulletin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/BoilingSoup/repo-bulletin/internal/repocache"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats a bulletin can be exported and imported in. YAML holds the same
+// document as JSON.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Export is a bulletin as it is exported, for a backup or to move it to
+// another bulletin or account, and as it is imported. It is the payload
+// with the bulletin's title and visibility, and each GitHub repo also named
+// by its full name.
+type Export struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Title         string            `json:"title,omitempty"`
+	Visibility    string            `json:"visibility,omitempty"`
+	Sections      []ExportedSection `json:"sections"`
+}
+
+// ExportedSection is a Section whose Repos are exported.
+type ExportedSection struct {
+	Section
+	Repos []ExportedEntry `json:"repos"`
+}
+
+// ExportedEntry is an entry with the full name, owner/name, of its repo if
+// it is a GitHub repo. On import a full name takes precedence over the
+// repoID, which may then be left out.
+type ExportedEntry struct {
+	Entry
+	Repo string `json:"repo,omitempty"`
+}
+
+var repoNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9._-]+$`)
+
+// NewExport converts a stored bulletin to an Export. Repos are named as
+// the cache knows them; repos GitHub no longer resolves keep only their
+// ID.
+func NewExport(ctx context.Context, conn db.Querier, s *Stored) (*Export, error) {
+	meta, err := repocache.Lookup(ctx, conn, github.NewAppClient(), s.Data.RepoIDs())
+	if err != nil {
+		return nil, err
+	}
+
+	e := Export{
+		SchemaVersion: SchemaVersion,
+		Title:         s.Title,
+		Visibility:    s.Visibility,
+		Sections:      make([]ExportedSection, len(s.Data.Sections)),
+	}
+	for i, section := range s.Data.Sections {
+		entries := make([]ExportedEntry, len(section.Repos))
+		for j, entry := range section.Repos {
+			entries[j] = ExportedEntry{Entry: entry}
+			if m, ok := meta[entry.RepoID]; ok && entry.IsGitHubRepo() {
+				entries[j].Repo = m.FullName
+			}
+		}
+		e.Sections[i] = ExportedSection{Section: section, Repos: entries}
+	}
+	return &e, nil
+}
+
+// Marshal encodes the export in the given format.
+func (e *Export) Marshal(format string) ([]byte, error) {
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil || format != FormatYAML {
+		return b, err
+	}
+
+	// JSON is YAML, so decoding it keeps the field order; only the styles
+	// are changed to block style
+	var doc yaml.Node
+	err = yaml.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	return buf.Bytes(), err
+}
+
+// blockStyle drops the flow and quoting styles of a node decoded from JSON.
+// Multi-line strings, i.e. section descriptions, become literal blocks.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!str" && strings.Contains(n.Value, "\n") {
+		n.Style = yaml.LiteralStyle
+	}
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// DecodeExport reads an export in the given format, rejecting unknown
+// fields like Decode does.
+func DecodeExport(b []byte, format string) (*Export, []Violation) {
+	if format == FormatYAML {
+		var doc any
+		err := yaml.Unmarshal(b, &doc)
+		if err != nil {
+			return nil, []Violation{{Message: "malformed YAML: " + strings.TrimPrefix(err.Error(), "yaml: ")}}
+		}
+		b, err = json.Marshal(doc)
+		if err != nil {
+			// e.g. a mapping with keys that are not strings
+			return nil, []Violation{{Message: "YAML cannot be represented as JSON"}}
+		}
+	}
+
+	var e Export
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&e)
+	if err == nil {
+		if _, trailing := dec.Token(); trailing != io.EOF {
+			err = errors.New("unexpected data after the payload")
+		}
+	}
+	if err != nil {
+		return nil, []Violation{decodeViolation(b, err)}
+	}
+	return &e, nil
+}
+
+// Payload returns the exported payload. Repos must have been resolved
+// first.
+func (e *Export) Payload() Payload {
+	p := Payload{SchemaVersion: e.SchemaVersion, Sections: make([]Section, len(e.Sections))}
+	for i, section := range e.Sections {
+		p.Sections[i] = section.Section
+		p.Sections[i].Repos = make([]Entry, len(section.Repos))
+		for j, entry := range section.Repos {
+			p.Sections[i].Repos[j] = entry.Entry
+		}
+	}
+	return p
+}
+
+// Info returns the title and visibility to give the imported bulletin;
+// either is nil if the export leaves it out.
+func (e *Export) Info() InfoUpdate {
+	var u InfoUpdate
+	if e.Title != "" {
+		u.Title = &e.Title
+	}
+	if e.Visibility != "" {
+		u.Visibility = &e.Visibility
+	}
+	return u
+}
+
+// ResolveRepos sets the repoID of every GitHub repo named by its full name,
+// and reports a violation for every name that does not resolve. Names are
+// looked up among the repos the user may pin first, and only the rest are
+// asked of GitHub one by one.
+func (e *Export) ResolveRepos(ctx context.Context, user *db.User) ([]Violation, error) {
+	var violations []Violation
+	unresolved := map[string]bool{}
+	for i, section := range e.Sections {
+		for j, entry := range section.Repos {
+			if entry.Repo == "" {
+				continue
+			}
+			if !entry.IsGitHubRepo() {
+				violations = append(violations, Violation{
+					Path:    fmt.Sprintf("/sections/%d/repos/%d/repo", i, j),
+					Message: fmt.Sprintf("not allowed for kind %q", entry.Kind),
+				})
+				continue
+			}
+			if !repoNamePattern.MatchString(entry.Repo) {
+				violations = append(violations, Violation{
+					Path:    fmt.Sprintf("/sections/%d/repos/%d/repo", i, j),
+					Message: "must be a repo's full name, owner/name",
+				})
+				continue
+			}
+			unresolved[strings.ToLower(entry.Repo)] = true
+		}
+	}
+	if len(unresolved) == 0 {
+		return violations, nil
+	}
+
+	ids := map[string]int{}
+	listed, err := pinnableRepos(ctx, user)
+	if err != nil {
+		return nil, ErrGitHub
+	}
+	for _, repo := range listed {
+		name := strings.ToLower(repo.FullName)
+		if unresolved[name] {
+			ids[name] = repo.ID
+			delete(unresolved, name)
+		}
+	}
+
+	client := github.NewClient(user.AccessToken)
+	for name := range unresolved {
+		repo, err := client.RepoByName(ctx, name)
+		if github.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, ErrGitHub
+		}
+		ids[name] = repo.ID
+	}
+
+	for i, section := range e.Sections {
+		for j := range section.Repos {
+			entry := &section.Repos[j]
+			if entry.Repo == "" || !entry.IsGitHubRepo() || !repoNamePattern.MatchString(entry.Repo) {
+				continue
+			}
+			id, ok := ids[strings.ToLower(entry.Repo)]
+			if !ok {
+				violations = append(violations, Violation{
+					Path:    fmt.Sprintf("/sections/%d/repos/%d/repo", i, j),
+					Message: "repo does not exist",
+				})
+				continue
+			}
+			entry.RepoID = id
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,123 @@
+package bulletin
+
+import (
+	"strings"
+	"testing"
+)
+
+// YAML is decoded through JSON, so type errors must still point into the
+// document the user wrote.
+func TestDecodeExportYAMLPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		path string
+	}{
+		{
+			name: "repoID of a later entry",
+			yaml: `
+schemaVersion: 4
+sections:
+  - id: s1
+    name: Tools
+    repos:
+      - id: r1
+        repo: octocat/hello-world
+  - id: s2
+    name: Talks
+    repos:
+      - id: r2
+        repoID: 1
+      - id: r3
+        repoID: abc
+`,
+			path: "/sections/1/repos/1/repoID",
+		},
+		{
+			// YAML 1.2 has no yes/no booleans
+			name: "featured written as yes",
+			yaml: `
+sections:
+  - id: s1
+    name: Tools
+    repos:
+      - id: r1
+        repoID: 1
+        featured: yes
+`,
+			path: "/sections/0/repos/0/featured",
+		},
+		{
+			name: "section that is not a mapping",
+			yaml: `
+sections:
+  - id: s1
+    name: Tools
+    repos: [{id: r1, repoID: 1}]
+  - just a string
+`,
+			path: "/sections/1",
+		},
+		{name: "title that is a list", yaml: "title: [a, b]\nsections: []\n", path: "/title"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, violations := DecodeExport([]byte(tt.yaml), FormatYAML)
+			if len(violations) != 1 {
+				t.Fatalf("violations = %+v, want one", violations)
+			}
+			if violations[0].Path != tt.path || !strings.HasPrefix(violations[0].Message, "must be of type") {
+				t.Errorf("violation = %+v, want a type error at %s", violations[0], tt.path)
+			}
+		})
+	}
+}
+
+func TestDecodeExportYAMLErrors(t *testing.T) {
+	for name, doc := range map[string]string{
+		"malformed":      "sections: [\n",
+		"unknown field":  "sections: []\nowner: octocat\n",
+		"non-string key": "sections: []\n1: one\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, violations := DecodeExport([]byte(doc), FormatYAML)
+			if len(violations) != 1 || violations[0].Path != "" {
+				t.Errorf("violations = %+v, want one for the whole document", violations)
+			}
+		})
+	}
+}
+
+func TestDecodeExportYAMLMatchesJSON(t *testing.T) {
+	fromYAML, violations := DecodeExport([]byte(`
+schemaVersion: 4
+title: Work
+visibility: unlisted
+sections:
+  - id: s1
+    name: Tools
+    description: |
+      Two lines
+      of text.
+    repos:
+      - id: r1
+        repo: octocat/Hello-World
+        featured: true
+`), FormatYAML)
+	if violations != nil {
+		t.Fatal(violations)
+	}
+	fromJSON, violations := DecodeExport([]byte(`{"schemaVersion": 4, "title": "Work", "visibility": "unlisted", "sections": [
+		{"id": "s1", "name": "Tools", "description": "Two lines\nof text.\n",
+		 "repos": [{"id": "r1", "repo": "octocat/Hello-World", "featured": true}]}
+	]}`), FormatJSON)
+	if violations != nil {
+		t.Fatal(violations)
+	}
+
+	a, _ := fromYAML.Marshal(FormatJSON)
+	b, _ := fromJSON.Marshal(FormatJSON)
+	if string(a) != string(b) {
+		t.Errorf("YAML decodes to\n%s\nJSON to\n%s", a, b)
+	}
+}
@@ -0,0 +1,199 @@
+package bulletin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/BoilingSoup/repo-bulletin/internal/repocache"
+	"github.com/jackc/pgx/v5"
+)
+
+// Organization roles, as GitHub names them. An org bulletin's EditorRole
+// is the least role that may save it.
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+)
+
+// OrgBulletin is a bulletin owned by a GitHub organization. It has the same
+// structure as a user's, but no revision history.
+type OrgBulletin struct {
+	OrgID      int
+	Login      string
+	Data       Payload
+	Version    int64
+	EditorRole string
+}
+
+// ValidRole reports whether role is a known organization role.
+func ValidRole(role string) bool {
+	return role == RoleMember || role == RoleAdmin
+}
+
+// CanEdit reports whether a membership allows saving a bulletin that
+// requires editorRole. Pending invitations do not count.
+func CanEdit(m *github.Membership, editorRole string) bool {
+	if m == nil || m.State != "active" {
+		return false
+	}
+	return m.Role == RoleAdmin || editorRole == RoleMember
+}
+
+// FindOrg reads an organization's bulletin by login, ignoring case. It
+// returns pgx.ErrNoRows if the organization has none.
+func FindOrg(ctx context.Context, conn db.Querier, login string) (*OrgBulletin, error) {
+	return findOrg(ctx, conn, `SELECT org_id, login, data, version, editor_role FROM org_bulletins
+		WHERE lower(login) = lower($1);`, login)
+}
+
+// FindOrgByID is FindOrg by the organization's ID, which survives renames.
+func FindOrgByID(ctx context.Context, conn db.Querier, orgID int) (*OrgBulletin, error) {
+	return findOrg(ctx, conn, `SELECT org_id, login, data, version, editor_role FROM org_bulletins
+		WHERE org_id = $1;`, orgID)
+}
+
+func findOrg(ctx context.Context, conn db.Querier, sql string, arg any) (*OrgBulletin, error) {
+	row := conn.QueryRow(ctx, sql, arg)
+	o := OrgBulletin{}
+	err := row.Scan(&o.OrgID, &o.Login, &o.Data, &o.Version, &o.EditorRole)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// SaveOrg writes an organization's bulletin, saved by userID, and returns
+// its new version. login is the organization's current login, which GitHub
+// lets organizations change. If ifMatch is not empty the save only goes
+// through if it names the current version; otherwise a *VersionConflict is
+// returned.
+func SaveOrg(ctx context.Context, conn *pgx.Conn, org github.Org, userID int, data Payload, ifMatch string) (int64, error) {
+	data.SchemaVersion = SchemaVersion
+
+	var version int64
+	err := db.ExecuteTx(ctx, conn, func(tx pgx.Tx) error {
+		if ifMatch != "" {
+			var current int64
+			row := tx.QueryRow(ctx, `SELECT version FROM org_bulletins WHERE org_id = $1 FOR UPDATE;`, org.ID)
+			err := row.Scan(&current)
+			if err != nil && err != pgx.ErrNoRows {
+				return err
+			}
+			if !matchesIfMatch(ifMatch, current) {
+				return &VersionConflict{Current: current}
+			}
+		}
+
+		row := tx.QueryRow(ctx, `INSERT INTO org_bulletins (org_id, login, data, updated_by) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (org_id) DO UPDATE SET login = excluded.login, data = excluded.data,
+				version = org_bulletins.version + 1, updated_by = excluded.updated_by, updated_at = now()
+			RETURNING version;`, org.ID, org.Login, data, userID)
+		return row.Scan(&version)
+	})
+	return version, err
+}
+
+// SetOrgEditorRole changes the least role that may save an organization's
+// bulletin.
+func SetOrgEditorRole(ctx context.Context, conn db.Querier, orgID int, role string) error {
+	_, err := conn.Exec(ctx, `UPDATE org_bulletins SET editor_role = $1 WHERE org_id = $2;`, role, orgID)
+	return err
+}
+
+// CheckOrgRepoAccess reports a violation for every GitHub repo that is not
+// a public repo of the organization, in the same way as CheckRepoAccess,
+// and for every gist, since organizations have none. client lists the
+// organization's repos if the cache cannot tell, and looks up pinned repos
+// one by one if the listing is too long to follow to the end.
+func CheckOrgRepoAccess(ctx context.Context, conn db.Querier, client *github.Client, org github.Org, p Payload) ([]Violation, error) {
+	ids := p.RepoIDs()
+
+	cached, err := repocache.Fresh(ctx, conn, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := map[int]bool{}
+	unresolved := false
+	for _, id := range ids {
+		if meta, ok := cached[id]; ok && meta.OwnerID == org.ID {
+			valid[id] = true
+		} else {
+			unresolved = true
+		}
+	}
+
+	if unresolved {
+		orgRepos, err := client.ListOrgRepos(ctx, org.Login)
+		truncated := err == github.ErrTruncated
+		if err != nil && !truncated {
+			return nil, ErrGitHub
+		}
+
+		pinned := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			pinned[id] = true
+		}
+		for i := range orgRepos {
+			repo := &orgRepos[i]
+			valid[repo.ID] = true
+			if pinned[repo.ID] {
+				err := repocache.Store(ctx, conn, repocache.FromGitHub(repo))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if truncated {
+			for _, id := range ids {
+				if valid[id] {
+					continue
+				}
+				repo, err := client.Repo(ctx, id)
+				if github.IsNotFound(err) {
+					continue
+				}
+				if err != nil {
+					return nil, ErrGitHub
+				}
+				if repo.Private || repo.Owner.ID != org.ID {
+					continue
+				}
+				valid[id] = true
+				err = repocache.Store(ctx, conn, repocache.FromGitHub(repo))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var violations []Violation
+	for i, section := range p.Sections {
+		for j := range section.Repos {
+			repo := &section.Repos[j]
+			if repo.Kind == KindGist {
+				violations = append(violations, Violation{
+					Path:    fmt.Sprintf("/sections/%d/repos/%d/kind", i, j),
+					Message: "organizations cannot pin gists",
+				})
+				continue
+			}
+			if !repo.IsGitHubRepo() {
+				continue
+			}
+			if !valid[repo.RepoID] {
+				violations = append(violations, Violation{
+					Path:    fmt.Sprintf("/sections/%d/repos/%d/repoID", i, j),
+					Message: "repo is not one of the organization's public repos",
+				})
+				continue
+			}
+			repo.Relationship = RelationshipOwner
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,48 @@
+package bulletin
+
+import (
+	"testing"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+)
+
+func TestCanEdit(t *testing.T) {
+	active := func(role string) *github.Membership {
+		return &github.Membership{State: "active", Role: role}
+	}
+
+	tests := []struct {
+		name       string
+		membership *github.Membership
+		editorRole string
+		want       bool
+	}{
+		{name: "member of a members bulletin", membership: active(RoleMember), editorRole: RoleMember, want: true},
+		{name: "admin of a members bulletin", membership: active(RoleAdmin), editorRole: RoleMember, want: true},
+		{name: "admin of an admins bulletin", membership: active(RoleAdmin), editorRole: RoleAdmin, want: true},
+		{name: "member of an admins bulletin", membership: active(RoleMember), editorRole: RoleAdmin},
+		{name: "pending admin", membership: &github.Membership{State: "pending", Role: RoleAdmin}, editorRole: RoleMember},
+		{name: "billing manager", membership: active("billing_manager"), editorRole: RoleAdmin},
+		{name: "not a member", editorRole: RoleMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanEdit(tt.membership, tt.editorRole); got != tt.want {
+				t.Errorf("CanEdit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidRole(t *testing.T) {
+	for _, role := range []string{RoleMember, RoleAdmin} {
+		if !ValidRole(role) {
+			t.Errorf("ValidRole(%q) = false", role)
+		}
+	}
+	for _, role := range []string{"", "owner", "Admin", "billing_manager"} {
+		if ValidRole(role) {
+			t.Errorf("ValidRole(%q) = true", role)
+		}
+	}
+}
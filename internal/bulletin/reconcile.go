@@ -0,0 +1,364 @@
+package bulletin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/BoilingSoup/repo-bulletin/internal/notices"
+	"github.com/BoilingSoup/repo-bulletin/internal/repocache"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// ReconcileInterval is how often each bulletin is reconciled.
+	ReconcileInterval = 24 * time.Hour
+
+	// maxConcurrentChecks bounds parallel requests to GitHub.
+	maxConcurrentChecks = 8
+)
+
+// Notice kinds queued by Reconcile.
+const (
+	NoticeRepoMissing = "repo_missing"
+	NoticeRepoRenamed = "repo_renamed"
+)
+
+// ReconcileStats summarizes a Reconcile run.
+type ReconcileStats struct {
+	Checked  int `json:"checked"`
+	Changed  int `json:"changed"`
+	Conflict int `json:"conflict"`
+	Failed   int `json:"failed"`
+}
+
+// Reconcile checks the pinned repos of up to limit bulletins not checked
+// within ReconcileInterval, least recently checked first. Repos that were
+// deleted, made private or transferred away from the user get a Status, and
+// are removed if the user opted into pruning; repos that came back have it
+// cleared. The user is sent a notice for each newly missing or renamed
+// repo.
+//
+// Changes are saved as a new version only if the bulletin was not saved in
+// the meantime; otherwise the bulletin is left until it is due again.
+func Reconcile(ctx context.Context, conn *pgx.Conn, limit int) (ReconcileStats, error) {
+	var stats ReconcileStats
+
+	type key struct {
+		userID int
+		slug   string
+	}
+
+	rows, err := conn.Query(ctx, `SELECT user_id, slug FROM bulletins
+		WHERE reconciled_at IS NULL OR reconciled_at < $1 ORDER BY reconciled_at LIMIT $2;`,
+		time.Now().Add(-ReconcileInterval), limit)
+	if err != nil {
+		return stats, err
+	}
+	var keys []key
+	for rows.Next() {
+		var k key
+		err := rows.Scan(&k.userID, &k.slug)
+		if err != nil {
+			rows.Close()
+			return stats, err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	for _, k := range keys {
+		changed, err := reconcileBulletin(ctx, conn, k.userID, k.slug)
+		var conflict *VersionConflict
+		switch {
+		case errors.As(err, &conflict):
+			stats.Conflict++
+		case err != nil:
+			stats.Failed++
+		default:
+			stats.Checked++
+			if changed {
+				stats.Changed++
+			}
+		}
+
+		// attempts that failed are recorded too, or bulletins that always
+		// fail would be picked first by every run and crowd out the rest
+		_, err = conn.Exec(ctx, `UPDATE bulletins SET reconciled_at = now() WHERE user_id = $1 AND slug = $2;`, k.userID, k.slug)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// reconcileBulletin reconciles one of a user's bulletins and reports
+// whether it was changed.
+func reconcileBulletin(ctx context.Context, conn *pgx.Conn, userID int, slug string) (bool, error) {
+	user, err := db.FindUser(ctx, conn, userID)
+	if err != nil {
+		return false, err
+	}
+
+	stored, err := Find(ctx, conn, userID, slug)
+	if err != nil {
+		return false, err
+	}
+	data := stored.Data
+
+	ids := data.RepoIDs()
+	cached, err := repocache.Cached(ctx, conn, ids)
+	if err != nil {
+		return false, err
+	}
+
+	checks := checkRepos(ctx, user, data.relationships())
+
+	var missing, renamed []map[string]any
+	changed := false
+	for i := range data.Sections {
+		for j := range data.Sections[i].Repos {
+			repo := &data.Sections[i].Repos[j]
+			if !repo.IsGitHubRepo() {
+				continue
+			}
+			c, ok := checks[repo.RepoID]
+			if !ok || c.err != nil {
+				// GitHub could not tell; keep whatever we knew before
+				continue
+			}
+
+			if c.status == RepoDeleted || c.status == RepoPrivate {
+				// its metadata must no longer be served by Expand
+				err := repocache.Evict(ctx, conn, repo.RepoID)
+				if err != nil {
+					return false, err
+				}
+			}
+
+			if c.status != repo.Status {
+				if c.status != "" {
+					missing = append(missing, map[string]any{
+						"slug":     slug,
+						"repoID":   repo.RepoID,
+						"status":   c.status,
+						"fullName": fullName(cached[repo.RepoID]),
+						"pruned":   user.PruneMissingRepos,
+					})
+				}
+				repo.Status = c.status
+				changed = true
+			}
+
+			if c.repo != nil {
+				meta := repocache.FromGitHub(c.repo)
+				if old := cached[repo.RepoID]; old != nil && old.FullName != meta.FullName {
+					renamed = append(renamed, map[string]any{
+						"slug":   slug,
+						"repoID": repo.RepoID,
+						"from":   old.FullName,
+						"to":     meta.FullName,
+					})
+					cached[repo.RepoID] = meta
+				}
+				err := repocache.Store(ctx, conn, meta)
+				if err != nil {
+					return false, err
+				}
+			}
+		}
+	}
+
+	if user.PruneMissingRepos {
+		if data.prune() {
+			changed = true
+		} else {
+			// every repo is missing and all were kept, see prune
+			for _, n := range missing {
+				n["pruned"] = false
+			}
+		}
+	}
+
+	if changed {
+		_, err := Save(ctx, conn, userID, slug, "", data, InfoUpdate{}, ETag(stored.Version))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	for _, n := range missing {
+		err := notices.Add(ctx, conn, userID, NoticeRepoMissing, n)
+		if err != nil {
+			return changed, err
+		}
+	}
+	for _, n := range renamed {
+		err := notices.Add(ctx, conn, userID, NoticeRepoRenamed, n)
+		if err != nil {
+			return changed, err
+		}
+	}
+
+	return changed, nil
+}
+
+// prune removes repos with a Status, and sections left empty by it, and
+// reports whether anything was removed. A payload in which every repo has a
+// Status is left as it is, since a bulletin must keep at least one section.
+func (p *Payload) prune() bool {
+	kept := false
+	for _, section := range p.Sections {
+		for _, repo := range section.Repos {
+			kept = kept || repo.Status == ""
+		}
+	}
+	if !kept {
+		return false
+	}
+
+	pruned := false
+	sections := p.Sections[:0]
+	for _, section := range p.Sections {
+		repos := section.Repos[:0]
+		for _, repo := range section.Repos {
+			if repo.Status == "" {
+				repos = append(repos, repo)
+			}
+		}
+		if len(repos) < len(section.Repos) {
+			pruned = true
+			if len(repos) == 0 {
+				continue
+			}
+		}
+		section.Repos = repos
+		sections = append(sections, section)
+	}
+	p.Sections = sections
+	return pruned
+}
+
+type check struct {
+	// status is empty if the repo can still be shown
+	status string
+	// repo is the repo as GitHub returned it, if it is public
+	repo *github.Repo
+	err  error
+}
+
+// relationships maps each pinned repo to the user's relationship to it.
+func (p Payload) relationships() map[int]string {
+	related := map[int]string{}
+	for _, section := range p.Sections {
+		for _, repo := range section.Repos {
+			if repo.IsGitHubRepo() {
+				related[repo.RepoID] = repo.Relationship
+			}
+		}
+	}
+	return related
+}
+
+// checkRepos asks GitHub about each pinned repo in parallel.
+func checkRepos(ctx context.Context, user *db.User, related map[int]string) map[int]check {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		sem     = make(chan struct{}, maxConcurrentChecks)
+		checks  = make(map[int]check, len(related))
+		app     = github.NewAppClient()
+		client  = github.NewClient(user.AccessToken)
+		visible = &userRepos{user: user}
+	)
+
+	for id, relationship := range related {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id int, relationship string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			c := checkRepo(ctx, app, client, visible, user.ID, id, relationship)
+			mu.Lock()
+			checks[id] = c
+			mu.Unlock()
+		}(id, relationship)
+	}
+	wg.Wait()
+
+	return checks
+}
+
+// checkRepo works out a repo's status. GitHub answers 404 both for deleted
+// repos and for private ones the client cannot see, so a 404 is retried
+// with the user's own token, which can see their private repos. Only repos
+// pinned as the user's own or their organization's can be transferred
+// away; the user never owned collaborations and contributions.
+func checkRepo(ctx context.Context, app, client *github.Client, visible *userRepos, userID, id int, relationship string) check {
+	repo, err := app.Repo(ctx, id)
+	if github.IsNotFound(err) {
+		repo, err = client.Repo(ctx, id)
+		if github.IsNotFound(err) {
+			return check{status: RepoDeleted}
+		}
+	}
+	if err != nil {
+		return check{err: err}
+	}
+
+	if repo.Private {
+		// not kept, so a private repo's details never reach the cache
+		return check{status: RepoPrivate}
+	}
+	if repo.Owner.ID == userID || relationship == RelationshipCollaborator || relationship == RelationshipContributor {
+		return check{repo: repo}
+	}
+
+	// e.g. an organization repo the user may pin as a member
+	ok, err := visible.has(ctx, id)
+	if err != nil {
+		return check{err: err}
+	}
+	if !ok {
+		return check{status: RepoTransferred, repo: repo}
+	}
+	return check{repo: repo}
+}
+
+// userRepos lazily lists the repos the user may pin, at most once.
+type userRepos struct {
+	user *db.User
+	once sync.Once
+	ids  map[int]bool
+	err  error
+}
+
+func (u *userRepos) has(ctx context.Context, id int) (bool, error) {
+	u.once.Do(func() {
+		repos, err := pinnableRepos(ctx, u.user)
+		if err != nil {
+			u.err = err
+			return
+		}
+		u.ids = make(map[int]bool, len(repos))
+		for _, repo := range repos {
+			u.ids[repo.ID] = true
+		}
+	})
+	return u.ids[id], u.err
+}
+
+func fullName(meta *repocache.Metadata) string {
+	if meta == nil {
+		return ""
+	}
+	return meta.FullName
+}
@@ -0,0 +1,61 @@
+package bulletin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name       string
+		from       string
+		want       string
+		wantPruned bool
+	}{
+		{
+			name: "nothing missing",
+			from: `{"sections": [{"id": "a", "name": "A", "repos": [{"id": "r1", "repoID": 1}]}]}`,
+			want: `{"sections": [{"id": "a", "name": "A", "repos": [{"id": "r1", "repoID": 1}]}]}`,
+		},
+		{
+			name: "missing repo removed",
+			from: `{"sections": [{"id": "a", "name": "A", "repos": [{"id": "r1", "repoID": 1, "status": "deleted"}, {"id": "r2", "repoID": 2}]}]}`,
+			want: `{"sections": [{"id": "a", "name": "A", "repos": [{"id": "r2", "repoID": 2}]}]}`, wantPruned: true,
+		},
+		{
+			name: "section left empty removed",
+			from: `{"sections": [
+				{"id": "a", "name": "A", "repos": [{"id": "r1", "repoID": 1, "status": "private"}]},
+				{"id": "b", "name": "B", "repos": [{"id": "r2", "repoID": 2}]}
+			]}`,
+			want:       `{"sections": [{"id": "b", "name": "B", "repos": [{"id": "r2", "repoID": 2}]}]}`,
+			wantPruned: true,
+		},
+		{
+			name: "every repo missing",
+			from: `{"sections": [
+				{"id": "a", "name": "A", "repos": [{"id": "r1", "repoID": 1, "status": "deleted"}]},
+				{"id": "b", "name": "B", "repos": [{"id": "r2", "repoID": 2, "status": "transferred"}]}
+			]}`,
+			want: `{"sections": [
+				{"id": "a", "name": "A", "repos": [{"id": "r1", "repoID": 1, "status": "deleted"}]},
+				{"id": "b", "name": "B", "repos": [{"id": "r2", "repoID": 2, "status": "transferred"}]}
+			]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := payload(t, tt.from)
+			pruned := p.prune()
+			if pruned != tt.wantPruned {
+				t.Errorf("prune() = %v, want %v", pruned, tt.wantPruned)
+			}
+			if want := payload(t, tt.want); !reflect.DeepEqual(p, want) {
+				t.Errorf("pruned to %+v, want %+v", p, want)
+			}
+			if violations := p.Validate(); len(violations) > 0 {
+				t.Errorf("pruned payload is invalid: %v", violations)
+			}
+		})
+	}
+}
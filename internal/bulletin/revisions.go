@@ -0,0 +1,93 @@
+package bulletin
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+)
+
+// defaultMaxRevisions is used when BULLETIN_MAX_REVISIONS is unset.
+const defaultMaxRevisions = 50
+
+// Revision is a bulletin as it was saved at some version. Slug is the
+// bulletin's, and SessionID is the jti of the session that saved it. Data
+// is only loaded for single revisions, not listings.
+type Revision struct {
+	ID        string    `json:"id"`
+	Slug      string    `json:"slug"`
+	Version   int64     `json:"version"`
+	SessionID string    `json:"session"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      *Payload  `json:"data,omitempty"`
+}
+
+// MaxRevisions returns how many revisions are kept per bulletin.
+func MaxRevisions() int {
+	n, err := strconv.Atoi(os.Getenv("BULLETIN_MAX_REVISIONS"))
+	if err != nil || n < 1 {
+		return defaultMaxRevisions
+	}
+	return n
+}
+
+var revisionIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidRevisionID reports whether id is shaped like a revision ID, so
+// malformed input can be rejected before it reaches the DB.
+func ValidRevisionID(id string) bool {
+	return revisionIDPattern.MatchString(id)
+}
+
+// ListRevisions returns the revisions of one of the user's bulletins,
+// newest first, without data.
+func ListRevisions(ctx context.Context, conn db.Querier, userID int, slug string) ([]Revision, error) {
+	rows, err := conn.Query(ctx, `SELECT id::STRING, slug, version, COALESCE(session_id, ''), created_at
+		FROM bulletin_revisions WHERE user_id = $1 AND slug = $2 ORDER BY version DESC;`, userID, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		var r Revision
+		err := rows.Scan(&r.ID, &r.Slug, &r.Version, &r.SessionID, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// GetRevision returns one of the user's revisions with its data. It returns
+// pgx.ErrNoRows if the revision does not exist or belongs to someone else.
+func GetRevision(ctx context.Context, conn db.Querier, userID int, id string) (*Revision, error) {
+	r := Revision{Data: &Payload{}}
+	row := conn.QueryRow(ctx, `SELECT id::STRING, slug, version, COALESCE(session_id, ''), created_at, data
+		FROM bulletin_revisions WHERE id = $1 AND user_id = $2;`, id, userID)
+	err := row.Scan(&r.ID, &r.Slug, &r.Version, &r.SessionID, &r.CreatedAt, r.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// appendRevision records a saved version and prunes the oldest revisions
+// beyond MaxRevisions.
+func appendRevision(ctx context.Context, conn db.Querier, userID int, slug, sessionID string, version int64, data Payload) error {
+	_, err := conn.Exec(ctx, `INSERT INTO bulletin_revisions (user_id, slug, version, data, session_id) VALUES ($1, $2, $3, $4, NULLIF($5, ''));`,
+		userID, slug, version, data, sessionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Exec(ctx, `DELETE FROM bulletin_revisions WHERE user_id = $1 AND slug = $2 AND version <= (
+			SELECT version FROM bulletin_revisions WHERE user_id = $1 AND slug = $2 ORDER BY version DESC LIMIT 1 OFFSET $3
+		);`, userID, slug, MaxRevisions())
+	return err
+}
@@ -0,0 +1,36 @@
+package bulletin
+
+import "testing"
+
+func TestMaxRevisions(t *testing.T) {
+	for env, want := range map[string]int{
+		"":    defaultMaxRevisions,
+		"10":  10,
+		"1":   1,
+		"0":   defaultMaxRevisions,
+		"-5":  defaultMaxRevisions,
+		"ten": defaultMaxRevisions,
+	} {
+		t.Setenv("BULLETIN_MAX_REVISIONS", env)
+		if got := MaxRevisions(); got != want {
+			t.Errorf("MaxRevisions() with %q = %d, want %d", env, got, want)
+		}
+	}
+}
+
+func TestValidRevisionID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"6f1c2a5e-8b7d-4e3a-9c1f-0a2b3c4d5e6f":  true,
+		"6F1C2A5E-8B7D-4E3A-9C1F-0A2B3C4D5E6F":  true,
+		"6f1c2a5e8b7d4e3a9c1f0a2b3c4d5e6f":      false,
+		"6f1c2a5e-8b7d-4e3a-9c1f-0a2b3c4d5e6":   false,
+		"6f1c2a5e-8b7d-4e3a-9c1f-0a2b3c4d5e6fa": false,
+		"6f1c2a5e-8b7d-4e3a-9c1f-0a2b3c4d5e6g":  false,
+		"1 OR 1=1":                              false,
+		"":                                      false,
+	} {
+		if got := ValidRevisionID(id); got != want {
+			t.Errorf("ValidRevisionID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
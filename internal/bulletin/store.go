@@ -0,0 +1,264 @@
+package bulletin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultSlug is the slug of the bulletin served at /{login}. Others are
+// served at /{login}/{slug}.
+const DefaultSlug = "default"
+
+const (
+	MaxBulletins   = 20
+	MaxTitleLength = 100
+)
+
+// Visibilities of a bulletin. Unlisted bulletins can be read by anyone with
+// the link, but are left out of the listing of a user's bulletins and not
+// indexed. Private bulletins can only be read by their owner, or with a
+// share token.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+var (
+	// ErrTooManyBulletins is returned by Save when creating a bulletin
+	// would exceed MaxBulletins.
+	ErrTooManyBulletins = errors.New("Too many bulletins.")
+
+	// ErrSlugTaken is returned by Update when renaming to a slug that
+	// another of the user's bulletins has.
+	ErrSlugTaken = errors.New("Slug is already taken.")
+)
+
+// Info describes one of a user's bulletins, without its data.
+type Info struct {
+	Slug       string    `json:"slug"`
+	Title      string    `json:"title"`
+	Visibility string    `json:"visibility"`
+	Version    int64     `json:"version"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Stored is a bulletin as it is stored. ShareKey is the secret its share
+// tokens are bound to.
+type Stored struct {
+	Info
+	Data     Payload
+	ShareKey string
+}
+
+// InfoUpdate changes a bulletin's Info; nil fields are left as they are.
+type InfoUpdate struct {
+	Slug       *string `json:"slug"`
+	Title      *string `json:"title"`
+	Visibility *string `json:"visibility"`
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,38}[a-z0-9])?$`)
+
+// ValidSlug reports whether slug is lowercase letters, digits and inner
+// hyphens, at most 40 characters.
+func ValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
+// ValidVisibility reports whether v is a known visibility.
+func ValidVisibility(v string) bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// Validate checks every field that is set and returns all violations.
+func (u InfoUpdate) Validate() []Violation {
+	var v []Violation
+	if u.Slug != nil && !ValidSlug(*u.Slug) {
+		v = append(v, Violation{Path: "/slug", Message: "must be lowercase letters, digits and hyphens, at most 40 characters"})
+	}
+	if u.Title != nil && utf8.RuneCountInString(*u.Title) > MaxTitleLength {
+		v = append(v, Violation{Path: "/title", Message: fmt.Sprintf("must be at most %d characters", MaxTitleLength)})
+	}
+	if u.Visibility != nil && !ValidVisibility(*u.Visibility) {
+		v = append(v, Violation{Path: "/visibility", Message: fmt.Sprintf("must be %q, %q or %q", VisibilityPublic, VisibilityUnlisted, VisibilityPrivate)})
+	}
+	return v
+}
+
+// Find reads one of the user's bulletins. It returns pgx.ErrNoRows if the
+// user has no bulletin with the slug.
+func Find(ctx context.Context, conn db.Querier, userID int, slug string) (*Stored, error) {
+	row := conn.QueryRow(ctx, `SELECT slug, title, visibility, version, updated_at, data, share_key FROM bulletins
+		WHERE user_id = $1 AND slug = $2;`, userID, slug)
+	s := Stored{}
+	err := row.Scan(&s.Slug, &s.Title, &s.Visibility, &s.Version, &s.UpdatedAt, &s.Data, &s.ShareKey)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// List returns the Info of every bulletin of the user, the default one
+// first and the rest by slug. Unlisted and private bulletins are only
+// included if withHidden is set, i.e. for the user themselves.
+func List(ctx context.Context, conn db.Querier, userID int, withHidden bool) ([]Info, error) {
+	rows, err := conn.Query(ctx, `SELECT slug, title, visibility, version, updated_at FROM bulletins
+		WHERE user_id = $1 AND ($2 OR visibility = $3)
+		ORDER BY slug = $4 DESC, slug;`, userID, withHidden, VisibilityPublic, DefaultSlug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infos := []Info{}
+	for rows.Next() {
+		var i Info
+		err := rows.Scan(&i.Slug, &i.Title, &i.Visibility, &i.Version, &i.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, i)
+	}
+	return infos, rows.Err()
+}
+
+// Save writes one of the user's bulletins in a single upsert and appends it
+// to the revision history, retried as a whole if it loses a race with a
+// concurrent save, and returns its new version. A new slug creates a
+// bulletin, unless the user already has MaxBulletins. sessionID is the jti
+// of the session making the save, or empty for saves made by a background
+// job.
+//
+// The title and visibility set in info are written with the data, so that
+// e.g. an import of a private bulletin is never readable as a public one;
+// its Slug is ignored.
+//
+// If ifMatch is not empty the save only goes through if it names the
+// current version; otherwise a *VersionConflict is returned. Payloads of
+// older schema versions are stored as the current one.
+func Save(ctx context.Context, conn *pgx.Conn, userID int, slug, sessionID string, data Payload, info InfoUpdate, ifMatch string) (int64, error) {
+	data.SchemaVersion = SchemaVersion
+
+	var version int64
+	err := db.ExecuteTx(ctx, conn, func(tx pgx.Tx) error {
+		var current int64
+		row := tx.QueryRow(ctx, `SELECT version FROM bulletins WHERE user_id = $1 AND slug = $2 FOR UPDATE;`, userID, slug)
+		err := row.Scan(&current)
+		if err != nil && err != pgx.ErrNoRows {
+			return err
+		}
+		if ifMatch != "" && !matchesIfMatch(ifMatch, current) {
+			return &VersionConflict{Current: current}
+		}
+
+		if err == pgx.ErrNoRows {
+			var count int
+			row := tx.QueryRow(ctx, `SELECT count(*) FROM bulletins WHERE user_id = $1;`, userID)
+			err := row.Scan(&count)
+			if err != nil {
+				return err
+			}
+			if count >= MaxBulletins {
+				return ErrTooManyBulletins
+			}
+		}
+
+		row = tx.QueryRow(ctx, `INSERT INTO bulletins (user_id, slug, data, title, visibility)
+			VALUES ($1, $2, $3, COALESCE($4, ''), COALESCE($5, $6))
+			ON CONFLICT (user_id, slug) DO UPDATE SET data = excluded.data, title = COALESCE($4, bulletins.title),
+				visibility = COALESCE($5, bulletins.visibility), version = bulletins.version + 1, updated_at = now()
+			RETURNING version;`, userID, slug, data, info.Title, info.Visibility, VisibilityPublic)
+		err = row.Scan(&version)
+		if err != nil {
+			return err
+		}
+
+		return appendRevision(ctx, tx, userID, slug, sessionID, version, data)
+	})
+	return version, err
+}
+
+// Update changes the Info of one of the user's bulletins and returns the
+// result. Renaming also moves the bulletin's revisions, and invalidates its
+// share tokens by rotating its share key. It returns
+// pgx.ErrNoRows if the user has no bulletin with the slug.
+func Update(ctx context.Context, conn *pgx.Conn, userID int, slug string, u InfoUpdate) (*Info, error) {
+	var info Info
+	err := db.ExecuteTx(ctx, conn, func(tx pgx.Tx) error {
+		newSlug := slug
+		if u.Slug != nil && *u.Slug != slug {
+			newSlug = *u.Slug
+
+			var taken bool
+			row := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM bulletins WHERE user_id = $1 AND slug = $2);`, userID, newSlug)
+			err := row.Scan(&taken)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return ErrSlugTaken
+			}
+		}
+
+		row := tx.QueryRow(ctx, `UPDATE bulletins SET slug = $3, title = COALESCE($4, title),
+				visibility = COALESCE($5, visibility), updated_at = now(),
+				share_key = CASE WHEN $3 = $2 THEN share_key ELSE gen_random_uuid()::STRING END
+			WHERE user_id = $1 AND slug = $2
+			RETURNING slug, title, visibility, version, updated_at;`, userID, slug, newSlug, u.Title, u.Visibility)
+		err := row.Scan(&info.Slug, &info.Title, &info.Visibility, &info.Version, &info.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		if newSlug != slug {
+			_, err := tx.Exec(ctx, `UPDATE bulletin_revisions SET slug = $3 WHERE user_id = $1 AND slug = $2;`, userID, slug, newSlug)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Delete removes one of the user's bulletins with its revisions. It returns
+// pgx.ErrNoRows if the user has no bulletin with the slug.
+func Delete(ctx context.Context, conn *pgx.Conn, userID int, slug string) error {
+	return db.ExecuteTx(ctx, conn, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `DELETE FROM bulletins WHERE user_id = $1 AND slug = $2;`, userID, slug)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM bulletin_revisions WHERE user_id = $1 AND slug = $2;`, userID, slug)
+		return err
+	})
+}
+
+// DeleteAll removes every bulletin of the user with their revisions.
+func DeleteAll(ctx context.Context, conn db.Querier, userID int) error {
+	_, err := conn.Exec(ctx, `DELETE FROM bulletin_revisions WHERE user_id = $1;`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(ctx, `DELETE FROM bulletins WHERE user_id = $1;`, userID)
+	return err
+}
@@ -0,0 +1,245 @@
+package bulletin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// SyncFile is the file a user's default bulletin is synced from, in
+	// their profile repository {login}/{login}. It holds an Export, in YAML
+	// or JSON.
+	SyncFile = ".repo-bulletin.yml"
+
+	// SyncInterval is how often each opted in user's file is checked.
+	SyncInterval = time.Hour
+
+	// maxSyncBytes caps the size of a synced file, as /import does.
+	maxSyncBytes = 512 << 10
+)
+
+// Outcomes of a sync.
+const (
+	// SyncOK means the bulletin matches the file.
+	SyncOK = "synced"
+	// SyncMissing means the profile repository or the file does not exist.
+	SyncMissing = "missing"
+	// SyncInvalid means the file was rejected; Errors says why.
+	SyncInvalid = "invalid"
+	// SyncFailed means the file could not be read or saved, e.g. because
+	// GitHub could not be reached. It is tried again on the next run.
+	SyncFailed = "failed"
+)
+
+// SyncStatus is the outcome of the last sync of a user's file.
+type SyncStatus struct {
+	Status    string      `json:"status"`
+	Message   string      `json:"message,omitempty"`
+	Errors    []Violation `json:"errors,omitempty"`
+	CheckedAt time.Time   `json:"checkedAt"`
+	SyncedAt  *time.Time  `json:"syncedAt"`
+}
+
+// SyncStats summarizes a Sync run.
+type SyncStats struct {
+	Checked int `json:"checked"`
+	Synced  int `json:"synced"`
+	Invalid int `json:"invalid"`
+	Failed  int `json:"failed"`
+}
+
+// FindSyncStatus reads the outcome of the user's last sync. It returns
+// pgx.ErrNoRows if the user was never synced.
+func FindSyncStatus(ctx context.Context, conn db.Querier, userID int) (*SyncStatus, error) {
+	row := conn.QueryRow(ctx, `SELECT status, message, errors, checked_at, synced_at FROM profile_syncs
+		WHERE user_id = $1;`, userID)
+	s := SyncStatus{}
+	err := row.Scan(&s.Status, &s.Message, &s.Errors, &s.CheckedAt, &s.SyncedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ResetSync forgets the outcome of the user's last sync, so that their file
+// is synced on the next run even if it did not change, e.g. when they opt
+// in again.
+func ResetSync(ctx context.Context, conn db.Querier, userID int) error {
+	_, err := conn.Exec(ctx, `DELETE FROM profile_syncs WHERE user_id = $1;`, userID)
+	return err
+}
+
+// Sync checks the SyncFile of up to limit users who opted into syncing and
+// were not checked within SyncInterval, least recently checked first. A
+// file that changed since it was last synced is saved as the user's
+// default bulletin, after the same checks as /import. Edits made on the
+// site are kept until the file changes again.
+func Sync(ctx context.Context, conn *pgx.Conn, limit int) (SyncStats, error) {
+	var stats SyncStats
+
+	rows, err := conn.Query(ctx, `SELECT u.id, COALESCE(s.sha, '') FROM users u
+		LEFT JOIN profile_syncs s ON s.user_id = u.id
+		WHERE u.sync_from_profile AND (s.checked_at IS NULL OR s.checked_at < $1)
+		ORDER BY s.checked_at NULLS FIRST LIMIT $2;`, time.Now().Add(-SyncInterval), limit)
+	if err != nil {
+		return stats, err
+	}
+	synced := map[int]string{}
+	var ids []int
+	for rows.Next() {
+		var id int
+		var sha string
+		err := rows.Scan(&id, &sha)
+		if err != nil {
+			rows.Close()
+			return stats, err
+		}
+		ids = append(ids, id)
+		synced[id] = sha
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	for _, id := range ids {
+		r, err := syncUser(ctx, conn, id, synced[id])
+		if err != nil {
+			r = syncResult{status: SyncFailed, message: "Error syncing bulletin."}
+		}
+		switch r.status {
+		case SyncOK:
+			stats.Synced++
+		case SyncInvalid:
+			stats.Invalid++
+		case SyncFailed:
+			stats.Failed++
+		}
+		stats.Checked++
+
+		err = recordSync(ctx, conn, id, r)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// syncResult is the outcome of syncing one user. sha is the SHA of the file
+// if it was synced, and otherwise empty.
+type syncResult struct {
+	status     string
+	message    string
+	violations []Violation
+	sha        string
+}
+
+// syncUser reads the user's SyncFile and saves it if its SHA differs from
+// the one last synced. Problems with the file or with GitHub are reported
+// in the result; only database errors are returned.
+func syncUser(ctx context.Context, conn *pgx.Conn, userID int, lastSHA string) (syncResult, error) {
+	user, err := db.FindUser(ctx, conn, userID)
+	if err != nil {
+		return syncResult{}, err
+	}
+	if user.Login == "" {
+		return syncResult{status: SyncFailed, message: "Log in again to record your GitHub login."}, nil
+	}
+
+	file, err := github.NewClient(user.AccessToken).FileContents(ctx, user.Login, user.Login, SyncFile)
+	if github.IsNotFound(err) {
+		return syncResult{status: SyncMissing, message: fmt.Sprintf("%s/%s has no %s.", user.Login, user.Login, SyncFile)}, nil
+	}
+	if err != nil {
+		return syncResult{status: SyncFailed, message: "Failed to read the file from GitHub."}, nil
+	}
+	if file.SHA == lastSHA {
+		return syncResult{status: SyncOK, sha: file.SHA}, nil
+	}
+	if file.Size > maxSyncBytes || file.Content == nil {
+		return syncResult{status: SyncInvalid, message: "File too large."}, nil
+	}
+
+	invalid := func(message string, violations []Violation) (syncResult, error) {
+		return syncResult{status: SyncInvalid, message: message, violations: violations}, nil
+	}
+
+	export, violations := DecodeExport(file.Content, FormatYAML)
+	if violations == nil {
+		violations = export.Info().Validate()
+	}
+	if len(violations) > 0 {
+		return invalid("Bad payload.", violations)
+	}
+
+	violations, err = export.ResolveRepos(ctx, user)
+	if err == ErrGitHub {
+		return syncResult{status: SyncFailed, message: err.Error()}, nil
+	}
+	if err != nil {
+		return syncResult{}, err
+	}
+	if len(violations) > 0 {
+		return invalid("Unknown repos in payload.", violations)
+	}
+
+	data := export.Payload()
+	violations = data.Validate()
+	if len(violations) > 0 {
+		return invalid("Bad payload.", violations)
+	}
+	data.ClearStatuses()
+
+	violations, err = CheckRepoAccess(ctx, conn, user, data)
+	if err == ErrGitHub {
+		return syncResult{status: SyncFailed, message: err.Error()}, nil
+	}
+	if err != nil {
+		return syncResult{}, err
+	}
+	if len(violations) > 0 {
+		return invalid("Unauthorized repos in payload.", violations)
+	}
+
+	violations, err = CheckGistAccess(ctx, conn, user, data)
+	if err == ErrGitHub {
+		return syncResult{status: SyncFailed, message: "Failed to request user gists."}, nil
+	}
+	if err != nil {
+		return syncResult{}, err
+	}
+	if len(violations) > 0 {
+		return invalid("Unauthorized gists in payload.", violations)
+	}
+
+	_, err = Save(ctx, conn, userID, DefaultSlug, "", data, export.Info(), "")
+	if errors.Is(err, ErrTooManyBulletins) {
+		return invalid(err.Error(), nil)
+	}
+	if err != nil {
+		return syncResult{}, err
+	}
+
+	return syncResult{status: SyncOK, sha: file.SHA}, nil
+}
+
+// recordSync stores the outcome of a sync. The SHA of the last synced file
+// is kept through failures, so that a file that did not change is not
+// saved again once it can be read.
+func recordSync(ctx context.Context, conn db.Querier, userID int, r syncResult) error {
+	_, err := conn.Exec(ctx, `INSERT INTO profile_syncs (user_id, status, message, errors, sha, synced_at)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $2 = $6 THEN now() END)
+		ON CONFLICT (user_id) DO UPDATE SET status = excluded.status, message = excluded.message,
+			errors = excluded.errors, checked_at = now(),
+			sha = CASE WHEN excluded.sha = '' THEN profile_syncs.sha ELSE excluded.sha END,
+			synced_at = COALESCE(excluded.synced_at, profile_syncs.synced_at);`,
+		userID, r.status, r.message, r.violations, r.sha, SyncOK)
+	return err
+}
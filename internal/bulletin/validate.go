@@ -0,0 +1,358 @@
+package bulletin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/external"
+)
+
+// Violation is a single problem with a payload. Path is a JSON pointer to
+// the offending value, e.g. /sections/2/repos/0/repoID.
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Decode strictly decodes a payload: unknown fields, wrong types and
+// trailing data are reported rather than ignored.
+func Decode(b []byte) (Payload, []Violation) {
+	var p Payload
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&p)
+	if err == nil {
+		if _, trailing := dec.Token(); trailing != io.EOF {
+			err = errors.New("unexpected data after the payload")
+		}
+	}
+	if err != nil {
+		return p, []Violation{decodeViolation(b, err)}
+	}
+
+	return p, nil
+}
+
+func decodeViolation(b []byte, err error) Violation {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		// Field is dotted and loses slice indices, e.g. sections.repos.repoID,
+		// so the path is found again from the offset
+		return Violation{Path: pointerAt(b, typeErr.Offset), Message: fmt.Sprintf("must be of type %s", typeErr.Type)}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return Violation{Path: "", Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)}
+	}
+
+	return Violation{Path: "", Message: strings.TrimPrefix(err.Error(), "json: ")}
+}
+
+// pointerEscaper escapes a key as a JSON pointer reference token.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// pointerAt returns the JSON pointer to the value of b that ends at offset,
+// or whose opening bracket does, which is where json.UnmarshalTypeError
+// reports it. It returns "" if b has no such value.
+func pointerAt(b []byte, offset int64) string {
+	type level struct {
+		array   bool
+		index   int
+		key     string
+		wantKey bool
+	}
+	var stack []*level
+
+	pointer := func() string {
+		var sb strings.Builder
+		for _, l := range stack {
+			sb.WriteByte('/')
+			if l.array {
+				sb.WriteString(strconv.Itoa(l.index))
+			} else {
+				sb.WriteString(pointerEscaper.Replace(l.key))
+			}
+		}
+		return sb.String()
+	}
+	// next moves past a value of the innermost array or object
+	next := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.array {
+			top.index++
+		} else {
+			top.wantKey = true
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			next()
+			continue
+		}
+		if len(stack) > 0 && stack[len(stack)-1].wantKey {
+			top := stack[len(stack)-1]
+			top.key, _ = tok.(string)
+			top.wantKey = false
+			continue
+		}
+
+		if dec.InputOffset() >= offset {
+			return pointer()
+		}
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &level{wantKey: true})
+		case json.Delim('['):
+			stack = append(stack, &level{array: true})
+		default:
+			next()
+		}
+	}
+}
+
+// Validate checks every rule and returns all violations at once, so a
+// client can point out each problem instead of just the first.
+func (p Payload) Validate() []Violation {
+	var v []Violation
+	add := func(path, format string, args ...any) {
+		v = append(v, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if p.SchemaVersion < 0 || p.SchemaVersion > SchemaVersion {
+		add("/schemaVersion", "must be at most %d", SchemaVersion)
+	}
+	// fields from later versions in an older payload are most likely a
+	// client that forgot to bump schemaVersion
+	requires := func(path string, version int, set bool) {
+		if set && p.SchemaVersion < version {
+			add(path, "requires schemaVersion %d", version)
+		}
+	}
+
+	if len(p.Sections) == 0 {
+		add("/sections", "must contain at least one section")
+	}
+	if len(p.Sections) > MaxSections {
+		add("/sections", "must contain at most %d sections", MaxSections)
+	}
+
+	sectionIDs := map[string]bool{}
+	repoUUIDs := map[string]bool{}
+	for i, section := range p.Sections {
+		path := fmt.Sprintf("/sections/%d", i)
+
+		if section.Id == "" {
+			add(path+"/id", "must not be empty")
+		} else if sectionIDs[section.Id] {
+			add(path+"/id", "duplicate section id")
+		}
+		sectionIDs[section.Id] = true
+
+		if strings.TrimSpace(section.Name) == "" {
+			add(path+"/name", "must not be blank")
+		}
+		if utf8.RuneCountInString(section.Name) > MaxSectionNameLength {
+			add(path+"/name", "must be at most %d characters", MaxSectionNameLength)
+		}
+
+		requires(path+"/description", 2, section.Description != "")
+		if utf8.RuneCountInString(section.Description) > MaxSectionDescriptionLength {
+			add(path+"/description", "must be at most %d characters", MaxSectionDescriptionLength)
+		}
+		requires(path+"/layout", 2, section.Layout != "")
+		switch section.Layout {
+		case "", LayoutGrid, LayoutList:
+		default:
+			add(path+"/layout", "must be %q or %q", LayoutGrid, LayoutList)
+		}
+		requires(path+"/sort", 2, section.Sort != "")
+		switch section.Sort {
+		case "", SortManual, SortStars, SortName:
+		default:
+			add(path+"/sort", "must be %q, %q or %q", SortManual, SortStars, SortName)
+		}
+		requires(path+"/collapsed", 2, section.Collapsed)
+
+		if len(section.Repos) == 0 {
+			add(path+"/repos", "must contain at least one repo")
+		}
+		if len(section.Repos) > MaxReposPerSection {
+			add(path+"/repos", "must contain at most %d repos", MaxReposPerSection)
+		}
+
+		entryKeys := map[string]bool{}
+		for j, repo := range section.Repos {
+			repoPath := fmt.Sprintf("%s/repos/%d", path, j)
+
+			if repo.Id == "" {
+				add(repoPath+"/id", "must not be empty")
+			} else if repoUUIDs[repo.Id] {
+				add(repoPath+"/id", "duplicate repo id")
+			}
+			repoUUIDs[repo.Id] = true
+
+			requires(repoPath+"/kind", 3, repo.Kind != "")
+			requires(repoPath+"/kind", 4, repo.Kind == KindGist)
+			field, ok := validateEntry(repo, add, repoPath)
+			if ok {
+				kind := repo.Kind
+				if repo.IsGitHubRepo() {
+					kind = KindGitHubRepo
+				}
+				key := kind + ":" + field
+				if entryKeys[key] {
+					add(repoPath, "a section can not have duplicate entries")
+				}
+				entryKeys[key] = true
+			}
+
+			requires(repoPath+"/blurb", 2, repo.Blurb != "")
+			if utf8.RuneCountInString(repo.Blurb) > MaxBlurbLength {
+				add(repoPath+"/blurb", "must be at most %d characters", MaxBlurbLength)
+			} else if strings.ContainsAny(repo.Blurb, "\r\n") {
+				add(repoPath+"/blurb", "must be a single line")
+			}
+			requires(repoPath+"/featured", 2, repo.Featured)
+		}
+	}
+
+	return v
+}
+
+// kindFields lists the fields each kind of entry uses besides the common
+// ones.
+var kindFields = map[string][]string{
+	KindGitHubRepo:   {"repoID"},
+	KindLink:         {"url", "title"},
+	KindGitLabRepo:   {"project"},
+	KindCodebergRepo: {"project"},
+	KindNPMPackage:   {"package"},
+	KindGoModule:     {"module"},
+	KindGist:         {"gistID"},
+}
+
+var (
+	gitLabProjectPattern   = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)+$`)
+	codebergProjectPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+	npmPackagePattern      = regexp.MustCompile(`^(@[a-z0-9~-][a-z0-9._~-]*/)?[a-z0-9~-][a-z0-9._~-]*$`)
+	goModulePattern        = regexp.MustCompile(`^[a-z0-9.-]+\.[a-z]+(/[A-Za-z0-9._~-]+)*$`)
+	gistIDPattern          = regexp.MustCompile(`^[0-9a-f]{1,32}$`)
+)
+
+// validateEntry checks the kind specific fields of an entry. It returns the
+// value identifying the entry and whether the entry is valid.
+func validateEntry(e Entry, add func(path, format string, args ...any), path string) (string, bool) {
+	kind := e.Kind
+	if kind == "" {
+		kind = KindGitHubRepo
+	}
+	fields, known := kindFields[kind]
+	if !known {
+		add(path+"/kind", "unknown kind")
+		return "", false
+	}
+
+	allowed := map[string]bool{}
+	for _, f := range fields {
+		allowed[f] = true
+	}
+	valid := true
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"repoID", e.RepoID != 0},
+		{"url", e.URL != ""},
+		{"title", e.Title != ""},
+		{"project", e.Project != ""},
+		{"package", e.Package != ""},
+		{"module", e.Module != ""},
+		{"gistID", e.GistID != ""},
+	} {
+		if f.set && !allowed[f.name] {
+			add(path+"/"+f.name, "not allowed for kind %s", kind)
+			valid = false
+		}
+	}
+
+	switch kind {
+	case KindGitHubRepo:
+		if e.RepoID <= 0 {
+			add(path+"/repoID", "must be a GitHub repository ID")
+			return "", false
+		}
+		return strconv.Itoa(e.RepoID), valid
+
+	case KindLink:
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(e.URL) > MaxURLLength {
+			add(path+"/url", "must be an http(s) URL of at most %d characters", MaxURLLength)
+			valid = false
+		}
+		if strings.TrimSpace(e.Title) == "" {
+			add(path+"/title", "must not be blank")
+			valid = false
+		} else if utf8.RuneCountInString(e.Title) > MaxEntryTitleLength {
+			add(path+"/title", "must be at most %d characters", MaxEntryTitleLength)
+			valid = false
+		}
+		return e.URL, valid
+
+	case KindGitLabRepo:
+		if !gitLabProjectPattern.MatchString(e.Project) || external.HasDotSegment(e.Project) || len(e.Project) > MaxEntryNameLength {
+			add(path+"/project", "must be a GitLab project path, e.g. group/name")
+			valid = false
+		}
+		return e.Project, valid
+
+	case KindCodebergRepo:
+		if !codebergProjectPattern.MatchString(e.Project) || external.HasDotSegment(e.Project) || len(e.Project) > MaxEntryNameLength {
+			add(path+"/project", "must be a Codeberg repository, e.g. owner/name")
+			valid = false
+		}
+		return e.Project, valid
+
+	case KindNPMPackage:
+		if !npmPackagePattern.MatchString(e.Package) || len(e.Package) > MaxEntryNameLength {
+			add(path+"/package", "must be an npm package name")
+			valid = false
+		}
+		return e.Package, valid
+
+	case KindGoModule:
+		if !goModulePattern.MatchString(e.Module) || external.HasDotSegment(e.Module) || len(e.Module) > MaxEntryNameLength {
+			add(path+"/module", "must be a Go module path")
+			valid = false
+		}
+		return e.Module, valid
+
+	case KindGist:
+		if !gistIDPattern.MatchString(e.GistID) {
+			add(path+"/gistID", "must be a gist ID")
+			valid = false
+		}
+		return e.GistID, valid
+	}
+	return "", false
+}
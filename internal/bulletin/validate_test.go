@@ -0,0 +1,194 @@
+package bulletin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string // paths of the violations, in order
+	}{
+		{
+			name: "valid",
+			body: `{"sections": [{"id": "s1", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}, {"id": "r2", "repoID": 2}]}]}`,
+		},
+		{
+			name: "same repo in two sections",
+			body: `{"sections": [
+				{"id": "s1", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}]},
+				{"id": "s2", "name": "Favorites", "repos": [{"id": "r2", "repoID": 1}]}
+			]}`,
+		},
+		{name: "no sections", body: `{"sections": []}`, want: []string{"/sections"}},
+		{
+			name: "empty section",
+			body: `{"sections": [{"id": "s1", "name": "Tools", "repos": []}]}`,
+			want: []string{"/sections/0/repos"},
+		},
+		{
+			name: "duplicate section id",
+			body: `{"sections": [
+				{"id": "s1", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}]},
+				{"id": "s1", "name": "Favorites", "repos": [{"id": "r2", "repoID": 2}]}
+			]}`,
+			want: []string{"/sections/1/id"},
+		},
+		{
+			name: "duplicate repo in a section",
+			body: `{"sections": [{"id": "s1", "name": "Tools", "repos": [{"id": "r1", "repoID": 1}, {"id": "r2", "repoID": 1}]}]}`,
+			want: []string{"/sections/0/repos/1"},
+		},
+		{
+			name: "link without a URL",
+			body: `{"schemaVersion": 3, "sections": [{"id": "s1", "name": "Tools", "repos": [{"id": "r1", "kind": "link", "url": "example.com", "title": "Example"}]}]}`,
+			want: []string{"/sections/0/repos/0/url"},
+		},
+		{
+			name: "short gist ID",
+			body: `{"schemaVersion": 4, "sections": [{"id": "s1", "name": "Gists", "repos": [{"id": "r1", "kind": "gist", "gistID": "8f3a"}]}]}`,
+		},
+		{
+			name: "gist ID that is not hex",
+			body: `{"schemaVersion": 4, "sections": [{"id": "s1", "name": "Gists", "repos": [{"id": "r1", "kind": "gist", "gistID": "octocat"}]}]}`,
+			want: []string{"/sections/0/repos/0/gistID"},
+		},
+		{
+			name: "Codeberg project with dot segments",
+			body: `{"schemaVersion": 3, "sections": [{"id": "s1", "name": "Tools", "repos": [{"id": "r1", "kind": "codeberg_repo", "project": "../../users/x"}]}]}`,
+			want: []string{"/sections/0/repos/0/project"},
+		},
+		{
+			name: "Go module with a dot segment",
+			body: `{"schemaVersion": 3, "sections": [{"id": "s1", "name": "Tools", "repos": [{"id": "r1", "kind": "go_module", "module": "golang.org/x/.."}]}]}`,
+			want: []string{"/sections/0/repos/0/module"},
+		},
+		{
+			name: "dots inside names",
+			body: `{"schemaVersion": 3, "sections": [{"id": "s1", "name": "Tools", "repos": [
+				{"id": "r1", "kind": "codeberg_repo", "project": "forgejo/.profile"},
+				{"id": "r2", "kind": "go_module", "module": "gopkg.in/yaml.v3"},
+				{"id": "r3", "kind": "gitlab_repo", "project": "group/sub/name..x"}
+			]}]}`,
+		},
+		{
+			name: "kind before version 3",
+			body: `{"schemaVersion": 2, "sections": [{"id": "s1", "name": "Tools", "repos": [{"id": "r1", "kind": "npm_package", "package": "left-pad"}]}]}`,
+			want: []string{"/sections/0/repos/0/kind"},
+		},
+		{
+			name: "every problem is reported",
+			body: `{"sections": [
+				{"id": "", "name": " ", "repos": [{"id": "r1", "repoID": 0}]},
+				{"id": "s2", "name": "Tools", "repos": [{"id": "r1", "repoID": 2}, {"id": "", "repoID": -1}]}
+			]}`,
+			want: []string{
+				"/sections/0/id",
+				"/sections/0/name",
+				"/sections/0/repos/0/repoID",
+				"/sections/1/repos/0/id",
+				"/sections/1/repos/1/id",
+				"/sections/1/repos/1/repoID",
+			},
+		},
+		{
+			name: "long section name",
+			body: `{"sections": [{"id": "s1", "name": "` + strings.Repeat("a", MaxSectionNameLength+1) + `", "repos": [{"id": "r1", "repoID": 1}]}]}`,
+			want: []string{"/sections/0/name"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, violations := Decode([]byte(tt.body))
+			if violations != nil {
+				t.Fatalf("Decode: %v", violations)
+			}
+			var got []string
+			for _, v := range p.Validate() {
+				got = append(got, v.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations at %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Violation
+	}{
+		{
+			name: "wrong type",
+			body: `{"sections": {}}`,
+			want: Violation{Path: "/sections", Message: "must be of type []bulletin.Section"},
+		},
+		{
+			name: "wrong type in a later repo",
+			body: `{"sections": [{"id": "s1", "name": "a", "repos": [{"id": "r1", "repoID": 1}, {"id": "r2", "repoID": "2"}]}]}`,
+			want: Violation{Path: "/sections/0/repos/1/repoID", Message: "must be of type int"},
+		},
+		{
+			name: "wrong type in a later section",
+			body: `{"sections": [{"id": "s1", "name": "a", "repos": []}, {"id": "s2", "name": "b", "repos": {"id": "r1"}}]}`,
+			want: Violation{Path: "/sections/1/repos", Message: "must be of type []bulletin.Entry"},
+		},
+		{
+			name: "wrong type at the top",
+			body: `[]`,
+			want: Violation{Message: "must be of type bulletin.Payload"},
+		},
+		{
+			name: "unknown field",
+			body: `{"sections": [], "extra": 1}`,
+			want: Violation{Message: `unknown field "extra"`},
+		},
+		{
+			name: "trailing data",
+			body: `{"sections": []} {}`,
+			want: Violation{Message: "unexpected data after the payload"},
+		},
+		{
+			name: "malformed",
+			body: `{"sections": [}`,
+			want: Violation{Message: "malformed JSON at offset 15"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, violations := Decode([]byte(tt.body))
+			if len(violations) != 1 || violations[0] != tt.want {
+				t.Errorf("violations = %+v, want [%+v]", violations, tt.want)
+			}
+		})
+	}
+}
+
+func TestPointerAt(t *testing.T) {
+	doc := `{"a/b": {"c~d": [1, {"e": true}]}, "f": [[], "g"]}`
+	tests := []struct {
+		value string // the first occurrence of which is looked up
+		want  string
+	}{
+		{value: "1", want: "/a~1b/c~0d/0"},
+		{value: `{"e"`, want: "/a~1b/c~0d/1"},
+		{value: "true", want: "/a~1b/c~0d/1/e"},
+		{value: "[]", want: "/f/0"},
+		{value: `"g"`, want: "/f/1"},
+	}
+	for _, tt := range tests {
+		end := strings.Index(doc, tt.value) + len(tt.value)
+		if tt.value[0] == '{' || tt.value[0] == '[' {
+			// objects and arrays are reported at their opening bracket
+			end = strings.Index(doc, tt.value) + 1
+		}
+		if got := pointerAt([]byte(doc), int64(end)); got != tt.want {
+			t.Errorf("pointer to %s = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package bulletin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VersionConflict is returned by Save when If-Match does not name the
+// current version. Current is 0 if the bulletin does not exist yet.
+type VersionConflict struct {
+	Current int64
+}
+
+func (e *VersionConflict) Error() string {
+	return fmt.Sprintf("Bulletin is at version %d.", e.Current)
+}
+
+// ETag formats a bulletin version as a strong entity tag. Version 0 means
+// the bulletin does not exist and has no tag.
+func ETag(version int64) string {
+	if version <= 0 {
+		return ""
+	}
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// matchesIfMatch reports whether an If-Match header value is satisfied by
+// the current version, per RFC 9110: "*" matches any existing bulletin and
+// weak tags never match.
+func matchesIfMatch(ifMatch string, current int64) bool {
+	if strings.TrimSpace(ifMatch) == "*" {
+		return current > 0
+	}
+
+	etag := ETag(current)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		if current > 0 && strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
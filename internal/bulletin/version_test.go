@@ -0,0 +1,31 @@
+package bulletin
+
+import "testing"
+
+func TestMatchesIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		current int64
+		want    bool
+	}{
+		{name: "current version", ifMatch: `"3"`, current: 3, want: true},
+		{name: "older version", ifMatch: `"2"`, current: 3},
+		{name: "one of a list", ifMatch: `"1", "3"`, current: 3, want: true},
+		{name: "none of a list", ifMatch: `"1","2"`, current: 3},
+		{name: "weak tag", ifMatch: `W/"3"`, current: 3},
+		{name: "unquoted", ifMatch: `3`, current: 3},
+		{name: "star with bulletin", ifMatch: `*`, current: 3, want: true},
+		{name: "star with padding", ifMatch: ` * `, current: 1, want: true},
+		{name: "star without bulletin", ifMatch: `*`, current: 0},
+		{name: "tag without bulletin", ifMatch: `"0"`, current: 0},
+		{name: "empty tag without bulletin", ifMatch: `""`, current: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesIfMatch(tt.ifMatch, tt.current); got != tt.want {
+				t.Errorf("matchesIfMatch(%q, %d) = %v, want %v", tt.ifMatch, tt.current, got, tt.want)
+			}
+		})
+	}
+}
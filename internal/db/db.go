@@ -0,0 +1,35 @@
+// Package db connects the Netlify functions to CockroachDB.
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Connect opens a connection to the database at COCKROACHDB_URL. The caller
+// is responsible for closing it.
+func Connect(ctx context.Context) (*pgx.Conn, error) {
+	config, err := pgx.ParseConfig(os.Getenv("COCKROACHDB_URL"))
+	if err != nil {
+		return nil, errors.New("Failed to create DB config.")
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, errors.New("Failed to connect to DB.")
+	}
+
+	return conn, nil
+}
+
+// Querier is the subset of pgx.Conn and pgx.Tx used by the shared queries,
+// so they can run either on their own or inside a transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// maxRetries bounds how often ExecuteTx reruns a transaction that keeps
+// losing serialization conflicts.
+const maxRetries = 5
+
+// ExecuteTx runs fn inside a transaction and commits it. When CockroachDB
+// aborts the transaction with a retryable serialization error, fn is rerun
+// from the cockroach_restart savepoint, so fn must be safe to repeat.
+func ExecuteTx(ctx context.Context, conn *pgx.Conn, fn func(pgx.Tx) error) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SAVEPOINT cockroach_restart;`)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		err = fn(tx)
+		if err == nil {
+			_, err = tx.Exec(ctx, `RELEASE SAVEPOINT cockroach_restart;`)
+			if err == nil {
+				return tx.Commit(ctx)
+			}
+		}
+
+		if !isRetryable(err) || i == maxRetries {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `ROLLBACK TO SAVEPOINT cockroach_restart;`)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001"
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/secrets"
+	"github.com/jackc/pgx/v5"
+)
+
+// User is a row of the users table with its access token decrypted. Login
+// is empty for users who have not logged in since logins were recorded.
+type User struct {
+	ID          int
+	Login       string
+	AccessToken string
+
+	// PruneMissingRepos removes pinned repos from the user's bulletin once
+	// they are found deleted, private or transferred, rather than only
+	// marking them.
+	PruneMissingRepos bool
+
+	// RepoAccess is the user's access mode, deciding which repos they may
+	// pin; see the bulletin package.
+	RepoAccess string
+
+	// SyncFromProfile keeps the user's default bulletin in sync with a file
+	// in their profile repository; see the bulletin package.
+	SyncFromProfile bool
+}
+
+// FindUser reads a user and decrypts their GitHub access token. It returns
+// pgx.ErrNoRows if the user does not exist.
+func FindUser(ctx context.Context, conn Querier, id int) (*User, error) {
+	var stored string
+	row := conn.QueryRow(ctx, `SELECT id, COALESCE(login, ''), access_token, prune_missing_repos, repo_access, sync_from_profile FROM users WHERE id = $1;`, id)
+	u := User{}
+	err := row.Scan(&u.ID, &u.Login, &stored, &u.PruneMissingRepos, &u.RepoAccess, &u.SyncFromProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	u.AccessToken, err = secrets.Decrypt(stored, TokenContext(u.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// SaveUser creates the user or replaces their access token, encrypting it
+// before it is written.
+func SaveUser(ctx context.Context, conn Querier, id int, accessToken string) error {
+	sealed, err := secrets.Encrypt(accessToken, TokenContext(id))
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Exec(ctx, `INSERT INTO users (id, access_token) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET access_token = excluded.access_token;`, id, sealed)
+	return err
+}
+
+// SetPruneMissingRepos changes the user's PruneMissingRepos setting.
+func SetPruneMissingRepos(ctx context.Context, conn Querier, id int, prune bool) error {
+	_, err := conn.Exec(ctx, `UPDATE users SET prune_missing_repos = $1 WHERE id = $2;`, prune, id)
+	return err
+}
+
+// SetRepoAccess changes the user's RepoAccess setting.
+func SetRepoAccess(ctx context.Context, conn Querier, id int, mode string) error {
+	_, err := conn.Exec(ctx, `UPDATE users SET repo_access = $1 WHERE id = $2;`, mode, id)
+	return err
+}
+
+// SetSyncFromProfile changes the user's SyncFromProfile setting.
+func SetSyncFromProfile(ctx context.Context, conn Querier, id int, sync bool) error {
+	_, err := conn.Exec(ctx, `UPDATE users SET sync_from_profile = $1 WHERE id = $2;`, sync, id)
+	return err
+}
+
+// SetLogin records the user's current GitHub login. If it changed, the old
+// login is kept as an alias so that old URLs can redirect. Since GitHub
+// frees renamed logins, whoever holds a login now takes it over from any
+// other user or alias. Run it in a transaction.
+func SetLogin(ctx context.Context, conn Querier, id int, login string) error {
+	var old string
+	row := conn.QueryRow(ctx, `SELECT COALESCE(login, '') FROM users WHERE id = $1;`, id)
+	err := row.Scan(&old)
+	if err != nil {
+		return err
+	}
+	if old == login {
+		return nil
+	}
+
+	_, err = conn.Exec(ctx, `UPDATE users SET login = NULL WHERE lower(login) = lower($1) AND id <> $2;`, login, id)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(ctx, `DELETE FROM login_aliases WHERE login = lower($1);`, login)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(ctx, `UPDATE users SET login = $1 WHERE id = $2;`, login, id)
+	if err != nil {
+		return err
+	}
+
+	if old != "" && !strings.EqualFold(old, login) {
+		_, err = conn.Exec(ctx, `UPSERT INTO login_aliases (login, user_id, renamed_at) VALUES (lower($1), $2, now());`, old, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveLogin finds the user with the given login, ignoring case, falling
+// back to logins they were renamed from. It returns their current login,
+// which differs from the argument when the user was found by an old one.
+// It returns pgx.ErrNoRows if no user ever had the login.
+func ResolveLogin(ctx context.Context, conn Querier, login string) (int, string, error) {
+	var id int
+	var current string
+	row := conn.QueryRow(ctx, `SELECT id, login FROM users WHERE lower(login) = lower($1);`, login)
+	err := row.Scan(&id, &current)
+	if err != pgx.ErrNoRows {
+		return id, current, err
+	}
+
+	row = conn.QueryRow(ctx, `SELECT u.id, COALESCE(u.login, '') FROM login_aliases a
+		JOIN users u ON u.id = a.user_id WHERE a.login = lower($1);`, login)
+	err = row.Scan(&id, &current)
+	if err == nil && current == "" {
+		return 0, "", pgx.ErrNoRows
+	}
+	return id, current, err
+}
+
+// TokenContext is the associated data binding an encrypted access token to
+// the user it belongs to.
+func TokenContext(id int) string {
+	return "users.access_token:" + strconv.Itoa(id)
+}
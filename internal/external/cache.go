@@ -0,0 +1,130 @@
+package external
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+)
+
+const (
+	// TTL is how long a cached copy is served before it is refetched.
+	TTL = 6 * time.Hour
+
+	// maxConcurrentFetches bounds parallel requests to the sources.
+	maxConcurrentFetches = 8
+)
+
+// Lookup returns metadata for the given refs. Fresh copies come from the
+// cache; missing or stale ones are refetched and written back. If a refetch
+// fails, a stale copy is still returned. Refs no source can resolve are
+// absent from the result, and are cached as missing for the TTL so that
+// they are not asked for on every view.
+func Lookup(ctx context.Context, conn db.Querier, refs []Ref) (map[Ref]*Metadata, error) {
+	result := make(map[Ref]*Metadata, len(refs))
+	if len(refs) == 0 {
+		return result, nil
+	}
+
+	sources := make([]string, len(refs))
+	keys := make([]string, len(refs))
+	for i, ref := range refs {
+		sources[i], keys[i] = ref.Source, ref.Key
+	}
+
+	rows, err := conn.Query(ctx, `SELECT c.source, c.key, c.data, c.missing, c.fetched_at
+		FROM unnest($1::STRING[], $2::STRING[]) AS r (source, key)
+		JOIN external_cache c ON c.source = r.source AND c.key = r.key;`, sources, keys)
+	if err != nil {
+		return nil, err
+	}
+	fetchedAt := map[Ref]time.Time{}
+	for rows.Next() {
+		var ref Ref
+		var missing bool
+		var t time.Time
+		meta := &Metadata{}
+		err := rows.Scan(&ref.Source, &ref.Key, meta, &missing, &t)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !missing {
+			result[ref] = meta
+		}
+		fetchedAt[ref] = t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var stale []Ref
+	seen := map[Ref]bool{}
+	for _, ref := range refs {
+		t, ok := fetchedAt[ref]
+		if !seen[ref] && (!ok || time.Since(t) > TTL) {
+			stale = append(stale, ref)
+		}
+		seen[ref] = true
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxConcurrentFetches)
+		fetched = make([]*Metadata, len(stale))
+		missing = make([]bool, len(stale))
+	)
+	for i, ref := range stale {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, ref Ref) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			meta, err := Fetch(ctx, ref)
+			if err == nil {
+				fetched[i] = meta
+			}
+			missing[i] = IsNotFound(err)
+		}(i, ref)
+	}
+	wg.Wait()
+
+	for i, meta := range fetched {
+		if missing[i] {
+			delete(result, stale[i])
+			err := storeMissing(ctx, conn, stale[i])
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if meta == nil {
+			continue
+		}
+		result[stale[i]] = meta
+		err := Store(ctx, conn, stale[i], meta)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Store writes metadata to the cache, e.g. after a listing already returned
+// it.
+func Store(ctx context.Context, conn db.Querier, ref Ref, meta *Metadata) error {
+	_, err := conn.Exec(ctx, `UPSERT INTO external_cache (source, key, data, missing, fetched_at) VALUES ($1, $2, $3, false, now());`,
+		ref.Source, ref.Key, meta)
+	return err
+}
+
+// storeMissing caches that the source does not have the entry.
+func storeMissing(ctx context.Context, conn db.Querier, ref Ref) error {
+	_, err := conn.Exec(ctx, `UPSERT INTO external_cache (source, key, data, missing, fetched_at) VALUES ($1, $2, '{}', true, now());`,
+		ref.Source, ref.Key)
+	return err
+}
@@ -0,0 +1,273 @@
+// Package external resolves bulletin entries other than GitHub repos, e.g.
+// GitLab projects, npm packages and gists, to the metadata a bulletin
+// shows, and caches it in the external_cache table like repocache does for
+// GitHub repos.
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+)
+
+// Sources an entry can be resolved from.
+const (
+	GitLab   = "gitlab"
+	Codeberg = "codeberg"
+	NPM      = "npm"
+	Go       = "go"
+	Gist     = "gist"
+)
+
+// Ref names an entry at a source: a project path for GitLab and Codeberg,
+// a package name for npm, a module path for Go and an ID for gists.
+type Ref struct {
+	Source string
+	Key    string
+}
+
+// Metadata is what a bulletin shows for an external entry. Fields a source
+// does not have are left empty, e.g. Stars for packages and Version for
+// projects. Owner and Files are only set for gists.
+type Metadata struct {
+	Name        string   `json:"name"`
+	FullName    string   `json:"fullName"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Language    string   `json:"language,omitempty"`
+	Topics      []string `json:"topics,omitempty"`
+	Stars       int      `json:"stars,omitempty"`
+	Forks       int      `json:"forks,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Files       []File   `json:"files,omitempty"`
+}
+
+// File is one of a gist's files.
+type File struct {
+	Name     string `json:"name"`
+	Language string `json:"language,omitempty"`
+	Size     int    `json:"size"`
+}
+
+// StatusError is returned when a source answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s responded %d", e.URL, e.StatusCode)
+}
+
+// IsNotFound reports whether err is a source saying the entry does not
+// exist. The module proxy answers 410 Gone for modules it cannot fetch.
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone
+	}
+	return github.IsNotFound(err)
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// HasDotSegment reports whether a key has a . or .. path segment, which a
+// source would resolve to another endpoint than the entry's.
+func HasDotSegment(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch asks the source for an entry's metadata.
+func Fetch(ctx context.Context, ref Ref) (*Metadata, error) {
+	if HasDotSegment(ref.Key) {
+		return nil, fmt.Errorf("invalid %s key %q", ref.Source, ref.Key)
+	}
+	switch ref.Source {
+	case GitLab:
+		return fetchGitLab(ctx, ref.Key)
+	case Codeberg:
+		return fetchCodeberg(ctx, ref.Key)
+	case NPM:
+		return fetchNPM(ctx, ref.Key)
+	case Go:
+		return fetchGo(ctx, ref.Key)
+	case Gist:
+		g, err := github.NewAppClient().Gist(ctx, ref.Key)
+		if err != nil {
+			return nil, err
+		}
+		return FromGist(g), nil
+	}
+	return nil, fmt.Errorf("unknown source %q", ref.Source)
+}
+
+func fetchGitLab(ctx context.Context, project string) (*Metadata, error) {
+	var p struct {
+		Name              string   `json:"name"`
+		PathWithNamespace string   `json:"path_with_namespace"`
+		Description       string   `json:"description"`
+		WebURL            string   `json:"web_url"`
+		Topics            []string `json:"topics"`
+		StarCount         int      `json:"star_count"`
+		ForksCount        int      `json:"forks_count"`
+	}
+	err := get(ctx, "https://gitlab.com/api/v4/projects/"+url.PathEscape(project), &p)
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{
+		Name:        p.Name,
+		FullName:    p.PathWithNamespace,
+		Description: p.Description,
+		URL:         p.WebURL,
+		Topics:      p.Topics,
+		Stars:       p.StarCount,
+		Forks:       p.ForksCount,
+	}, nil
+}
+
+func fetchCodeberg(ctx context.Context, project string) (*Metadata, error) {
+	var r struct {
+		Name        string   `json:"name"`
+		FullName    string   `json:"full_name"`
+		Description string   `json:"description"`
+		HTMLURL     string   `json:"html_url"`
+		Language    string   `json:"language"`
+		Topics      []string `json:"topics"`
+		StarsCount  int      `json:"stars_count"`
+		ForksCount  int      `json:"forks_count"`
+	}
+	owner, name, _ := strings.Cut(project, "/")
+	err := get(ctx, "https://codeberg.org/api/v1/repos/"+url.PathEscape(owner)+"/"+url.PathEscape(name), &r)
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{
+		Name:        r.Name,
+		FullName:    r.FullName,
+		Description: r.Description,
+		URL:         r.HTMLURL,
+		Language:    r.Language,
+		Topics:      r.Topics,
+		Stars:       r.StarsCount,
+		Forks:       r.ForksCount,
+	}, nil
+}
+
+func fetchNPM(ctx context.Context, name string) (*Metadata, error) {
+	var p struct {
+		Name        string            `json:"name"`
+		Description string            `json:"description"`
+		DistTags    map[string]string `json:"dist-tags"`
+		Keywords    []string          `json:"keywords"`
+	}
+	// scoped names keep their @ but escape the slash
+	err := get(ctx, "https://registry.npmjs.org/"+strings.Replace(name, "/", "%2F", 1), &p)
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{
+		Name:        p.Name,
+		FullName:    p.Name,
+		Description: p.Description,
+		URL:         "https://www.npmjs.com/package/" + p.Name,
+		Language:    "JavaScript",
+		Topics:      p.Keywords,
+		Version:     p.DistTags["latest"],
+	}, nil
+}
+
+func fetchGo(ctx context.Context, module string) (*Metadata, error) {
+	var info struct {
+		Version string `json:"Version"`
+	}
+	err := get(ctx, "https://proxy.golang.org/"+escapeModulePath(module)+"/@latest", &info)
+	if err != nil {
+		return nil, err
+	}
+	name := module[strings.LastIndex(module, "/")+1:]
+	return &Metadata{
+		Name:     name,
+		FullName: module,
+		URL:      "https://pkg.go.dev/" + module,
+		Language: "Go",
+		Version:  info.Version,
+	}, nil
+}
+
+// FromGist converts a GitHub API gist to metadata. Its name is its first
+// file's, as on GitHub, and its language the first file's that has one.
+func FromGist(g *github.Gist) *Metadata {
+	names := make([]string, 0, len(g.Files))
+	for name := range g.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	meta := &Metadata{
+		FullName:    g.Owner.Login + "/" + g.ID,
+		Description: g.Description,
+		URL:         g.HTMLURL,
+		Owner:       g.Owner.Login,
+		Files:       make([]File, len(names)),
+	}
+	for i, name := range names {
+		f := g.Files[name]
+		meta.Files[i] = File{Name: name, Language: f.Language, Size: f.Size}
+		if meta.Language == "" {
+			meta.Language = f.Language
+		}
+	}
+	if len(names) > 0 {
+		meta.Name = names[0]
+	}
+	return meta
+}
+
+// escapeModulePath applies the module proxy's case encoding, in which an
+// upper case letter is written as ! followed by the lower case letter.
+func escapeModulePath(module string) string {
+	var b strings.Builder
+	for _, r := range module {
+		if 'A' <= r && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// get requests url and decodes a successful JSON response into dst.
+func get(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode, URL: url}
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
@@ -0,0 +1,38 @@
+package external
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEscapeModulePath(t *testing.T) {
+	tests := []struct {
+		module string
+		want   string
+	}{
+		{"golang.org/x/tools", "golang.org/x/tools"},
+		{"github.com/BurntSushi/toml", "github.com/!burnt!sushi/toml"},
+		{"github.com/Azure/azure-sdk-for-go", "github.com/!azure/azure-sdk-for-go"},
+		{"example.com/ABC", "example.com/!a!b!c"},
+		{"example.com/ünïcode", "example.com/ünïcode"},
+	}
+	for _, tt := range tests {
+		if got := escapeModulePath(tt.module); got != tt.want {
+			t.Errorf("escapeModulePath(%q) = %q, want %q", tt.module, got, tt.want)
+		}
+	}
+}
+
+func TestFetchRejectsDotSegments(t *testing.T) {
+	for _, ref := range []Ref{
+		{Source: Codeberg, Key: "../../users/x"},
+		{Source: Codeberg, Key: "owner/.."},
+		{Source: Go, Key: "example.com/./x"},
+		{Source: GitLab, Key: "group/../other"},
+	} {
+		// rejected before any request is made
+		if _, err := Fetch(context.Background(), ref); err == nil {
+			t.Errorf("Fetch(%+v) succeeded", ref)
+		}
+	}
+}
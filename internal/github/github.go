@@ -0,0 +1,434 @@
+// Package github is a small client for the parts of the GitHub REST API the
+// functions use.
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	apiURL     = "https://api.github.com"
+	graphqlURL = apiURL + "/graphql"
+)
+
+// maxPages bounds how many pages a listing follows, i.e. 5,000 items.
+const maxPages = 50
+
+// ErrTruncated is returned with the items listed so far when a listing has
+// more than maxPages pages. Callers should look up what they did not find
+// one by one rather than take it as missing.
+var ErrTruncated = errors.New("listing has more pages than are followed")
+
+// StatusError is returned when GitHub answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GitHub responded %d for %s", e.StatusCode, e.URL)
+}
+
+// Client makes requests on behalf of a user, or anonymously if the token is
+// empty.
+type Client struct {
+	token string
+	http  *http.Client
+}
+
+// NewClient returns a client authenticating with the given access token.
+func NewClient(token string) *Client {
+	return &Client{token: token, http: &http.Client{}}
+}
+
+// NewAppClient returns a client for requests not made on behalf of a user,
+// e.g. for anonymous visitors. It uses GITHUB_PAT when set, which has a far
+// higher rate limit than unauthenticated requests.
+func NewAppClient() *Client {
+	return NewClient(os.Getenv("GITHUB_PAT"))
+}
+
+// IsNotFound reports whether err is GitHub answering 404, which it also
+// does for private repositories the client cannot see.
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+type User struct {
+	ID    int    `json:"id"`
+	Login string `json:"login"`
+}
+
+type Org struct {
+	ID    int    `json:"id"`
+	Login string `json:"login"`
+}
+
+// Membership is the authenticated user's membership in an organization.
+// State is "active" or "pending" and Role is "admin" or "member".
+type Membership struct {
+	State        string `json:"state"`
+	Role         string `json:"role"`
+	Organization Org    `json:"organization"`
+}
+
+type Owner struct {
+	ID    int    `json:"id"`
+	Login string `json:"login"`
+	Type  string `json:"type"`
+}
+
+type Repo struct {
+	ID              int      `json:"id"`
+	Name            string   `json:"name"`
+	FullName        string   `json:"full_name"`
+	Description     string   `json:"description"`
+	HTMLURL         string   `json:"html_url"`
+	Language        string   `json:"language"`
+	Topics          []string `json:"topics"`
+	StargazersCount int      `json:"stargazers_count"`
+	ForksCount      int      `json:"forks_count"`
+	Fork            bool     `json:"fork"`
+	Private         bool     `json:"private"`
+	Owner           Owner    `json:"owner"`
+	// Permissions are the authenticated user's, and only present on
+	// repos requested with a user's token.
+	Permissions Permissions `json:"permissions"`
+}
+
+type Permissions struct {
+	Admin bool `json:"admin"`
+	Push  bool `json:"push"`
+	Pull  bool `json:"pull"`
+}
+
+type GistFile struct {
+	Filename string `json:"filename"`
+	Language string `json:"language"`
+	Size     int    `json:"size"`
+}
+
+type Gist struct {
+	ID          string              `json:"id"`
+	Description string              `json:"description"`
+	HTMLURL     string              `json:"html_url"`
+	Public      bool                `json:"public"`
+	Owner       Owner               `json:"owner"`
+	Files       map[string]GistFile `json:"files"`
+}
+
+// User returns the authenticated user.
+func (c *Client) User(ctx context.Context) (*User, error) {
+	var u User
+	_, err := c.get(ctx, apiURL+"/user", &u)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Repo returns the repository with the given ID. IDs survive renames and
+// transfers, unlike owner/name.
+func (c *Client) Repo(ctx context.Context, id int) (*Repo, error) {
+	r, _, err := c.RepoIfNoneMatch(ctx, id, "")
+	return r, err
+}
+
+// RepoByName returns the repository with the given full name, owner/name.
+// GitHub redirects names the repository had before a rename or transfer.
+func (c *Client) RepoByName(ctx context.Context, fullName string) (*Repo, error) {
+	owner, name, ok := strings.Cut(fullName, "/")
+	if !ok {
+		return nil, fmt.Errorf("malformed repository name %q", fullName)
+	}
+	var r Repo
+	_, err := c.get(ctx, apiURL+"/repos/"+url.PathEscape(owner)+"/"+url.PathEscape(name), &r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// RepoIfNoneMatch is Repo as a conditional request. If etag is still
+// current GitHub answers 304, which does not count against the rate limit,
+// and the returned repo is nil. Otherwise the repo is returned with its new
+// ETag.
+func (c *Client) RepoIfNoneMatch(ctx context.Context, id int, etag string) (*Repo, string, error) {
+	var r Repo
+	url := fmt.Sprintf("%s/repositories/%d", apiURL, id)
+	resp, err := c.do(ctx, url, map[string]string{"If-None-Match": etag}, &r)
+	if resp != nil && resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &r, resp.Header.Get("ETag"), nil
+}
+
+// File is a file read from a repository's default branch. SHA is its blob
+// SHA, which changes with its content.
+type File struct {
+	SHA     string
+	Size    int
+	Content []byte
+}
+
+// FileContents reads the file at path in the repository owner/repo. Files
+// over 1 MB have no Content, as GitHub leaves it out.
+func (c *Client) FileContents(ctx context.Context, owner, repo, path string) (*File, error) {
+	var f struct {
+		Type     string `json:"type"`
+		SHA      string `json:"sha"`
+		Size     int    `json:"size"`
+		Encoding string `json:"encoding"`
+		Content  string `json:"content"`
+	}
+	u := apiURL + "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo) + "/contents/" + path
+	_, err := c.get(ctx, u, &f)
+	if err != nil {
+		return nil, err
+	}
+	if f.Type != "file" {
+		return nil, fmt.Errorf("%s is a %s, not a file", path, f.Type)
+	}
+
+	file := &File{SHA: f.SHA, Size: f.Size}
+	if f.Encoding == "base64" {
+		file.Content, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(f.Content, "\n", ""))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// Affiliations of the authenticated user with a repository, for ListRepos.
+const (
+	AffiliationOwner              = "owner"
+	AffiliationCollaborator       = "collaborator"
+	AffiliationOrganizationMember = "organization_member"
+)
+
+// Gist returns the gist with the given ID, secret or not.
+func (c *Client) Gist(ctx context.Context, id string) (*Gist, error) {
+	var g Gist
+	_, err := c.get(ctx, apiURL+"/gists/"+url.PathEscape(id), &g)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// ListGists returns every gist of the authenticated user, secret ones
+// included, following pagination. Past maxPages it returns the gists so far
+// with ErrTruncated.
+func (c *Client) ListGists(ctx context.Context) ([]Gist, error) {
+	var gists []Gist
+	next := apiURL + "/gists?per_page=100"
+	for page := 0; next != ""; page++ {
+		if page == maxPages {
+			return gists, ErrTruncated
+		}
+		var batch []Gist
+		resp, err := c.get(ctx, next, &batch)
+		if err != nil {
+			return nil, err
+		}
+		gists = append(gists, batch...)
+		next = nextPage(resp.Header.Get("Link"))
+	}
+	return gists, nil
+}
+
+// Membership returns the authenticated user's membership in the given
+// organization. GitHub answers 404 if the user is not a member, and 403 if
+// the token lacks the read:org scope.
+func (c *Client) Membership(ctx context.Context, org string) (*Membership, error) {
+	var m Membership
+	_, err := c.get(ctx, apiURL+"/user/memberships/orgs/"+url.PathEscape(org), &m)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListOrgRepos returns every public repository of the given organization,
+// following pagination.
+func (c *Client) ListOrgRepos(ctx context.Context, org string) ([]Repo, error) {
+	return c.list(ctx, apiURL+"/orgs/"+url.PathEscape(org)+"/repos?type=public&per_page=100")
+}
+
+// ListRepos returns every public repository the authenticated user has one
+// of the given affiliations with, following pagination.
+func (c *Client) ListRepos(ctx context.Context, affiliations ...string) ([]Repo, error) {
+	return c.list(ctx, apiURL+"/user/repos?affiliation="+strings.Join(affiliations, ",")+"&visibility=public&per_page=100")
+}
+
+// list requests a listing of repos, following pagination. Past maxPages
+// it returns the repos so far with ErrTruncated.
+func (c *Client) list(ctx context.Context, url string) ([]Repo, error) {
+	var repos []Repo
+	for page := 0; url != ""; page++ {
+		if page == maxPages {
+			return repos, ErrTruncated
+		}
+		var batch []Repo
+		resp, err := c.get(ctx, url, &batch)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, batch...)
+		url = nextPage(resp.Header.Get("Link"))
+	}
+
+	return repos, nil
+}
+
+// ContributedRepos returns the IDs of public repositories owned by someone
+// else that the authenticated user contributed commits, pull requests or
+// issues to. GitHub only counts contributions from the past year. Past
+// maxPages it returns the IDs so far with ErrTruncated.
+func (c *Client) ContributedRepos(ctx context.Context) ([]int, error) {
+	const query = `query($after: String) {
+	  viewer {
+	    repositoriesContributedTo(first: 100, after: $after, privacy: PUBLIC, includeUserRepositories: false,
+	      contributionTypes: [COMMIT, PULL_REQUEST, ISSUE]) {
+	      nodes { databaseId }
+	      pageInfo { hasNextPage endCursor }
+	    }
+	  }
+	}`
+
+	var ids []int
+	var after *string
+	for page := 0; ; page++ {
+		if page == maxPages {
+			return ids, ErrTruncated
+		}
+		var resp struct {
+			Data struct {
+				Viewer struct {
+					RepositoriesContributedTo struct {
+						Nodes []struct {
+							DatabaseID int `json:"databaseId"`
+						} `json:"nodes"`
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+					} `json:"repositoriesContributedTo"`
+				} `json:"viewer"`
+			} `json:"data"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		err := c.graphql(ctx, query, map[string]any{"after": after}, &resp)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Errors) > 0 {
+			return nil, fmt.Errorf("GitHub GraphQL error: %s", resp.Errors[0].Message)
+		}
+
+		contributed := resp.Data.Viewer.RepositoriesContributedTo
+		for _, node := range contributed.Nodes {
+			ids = append(ids, node.DatabaseID)
+		}
+		if !contributed.PageInfo.HasNextPage {
+			break
+		}
+		after = &contributed.PageInfo.EndCursor
+	}
+
+	return ids, nil
+}
+
+// get requests url and decodes a successful JSON response into dst.
+func (c *Client) get(ctx context.Context, url string, dst any) (*http.Response, error) {
+	return c.do(ctx, url, nil, dst)
+}
+
+// graphql runs a GraphQL query and decodes the response into dst. GraphQL
+// reports most errors in the body rather than the status, so dst should
+// have an errors field.
+func (c *Client) graphql(ctx context.Context, query string, variables map[string]any, dst any) error {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, graphqlURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = c.send(req, dst)
+	return err
+}
+
+// do is get with extra request headers; empty values are skipped.
+func (c *Client) do(ctx context.Context, url string, headers map[string]string, dst any) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	return c.send(req, dst)
+}
+
+// send authenticates req and decodes a successful JSON response into dst.
+func (c *Client) send(req *http.Request, dst any) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, &StatusError{StatusCode: resp.StatusCode, URL: req.URL.String()}
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(dst)
+	if err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// nextPage extracts the rel="next" URL from a Link header, e.g.
+//
+//	<https://api.github.com/user/repos?page=2>; rel="next", <...>; rel="last"
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		url, params, ok := strings.Cut(strings.TrimSpace(part), ";")
+		if !ok {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(url), "<>")
+			}
+		}
+	}
+	return ""
+}
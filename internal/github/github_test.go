@@ -0,0 +1,74 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestNextPage(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{
+			link: `<https://api.github.com/user/repos?page=2>; rel="next", <https://api.github.com/user/repos?page=5>; rel="last"`,
+			want: "https://api.github.com/user/repos?page=2",
+		},
+		{
+			link: `<https://api.github.com/user/repos?page=1>; rel="prev", <https://api.github.com/user/repos?page=3>; rel="next"`,
+			want: "https://api.github.com/user/repos?page=3",
+		},
+		{
+			// the last page has no next link
+			link: `<https://api.github.com/user/repos?page=1>; rel="first", <https://api.github.com/user/repos?page=4>; rel="prev"`,
+			want: "",
+		},
+		{link: `<https://api.github.com/user/repos?page=2>;rel="next"`, want: "https://api.github.com/user/repos?page=2"},
+		{link: `<https://api.github.com/user/repos?page=2>; type="text"; rel="next"`, want: "https://api.github.com/user/repos?page=2"},
+		{link: `<https://api.github.com/user/repos?page=2>`, want: ""},
+		{link: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := nextPage(tt.link); got != tt.want {
+			t.Errorf("nextPage(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	tests := []struct {
+		name      string
+		pages     int
+		wantRepos int
+		wantErr   error
+	}{
+		{name: "single page", pages: 1, wantRepos: 1},
+		{name: "last page within the limit", pages: maxPages, wantRepos: maxPages},
+		{name: "more pages than the limit", pages: maxPages + 1, wantRepos: maxPages, wantErr: ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				if page < tt.pages-1 {
+					w.Header().Set("Link", fmt.Sprintf(`<%s/?page=%d>; rel="next"`, server.URL, page+1))
+				}
+				fmt.Fprintf(w, `[{"id": %d}]`, page+1)
+			}))
+			defer server.Close()
+
+			repos, err := NewClient("").list(context.Background(), server.URL+"/?page=0")
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if len(repos) != tt.wantRepos {
+				t.Errorf("got %d repos, want %d", len(repos), tt.wantRepos)
+			}
+		})
+	}
+}
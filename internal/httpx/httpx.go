@@ -0,0 +1,154 @@
+// Package httpx holds the response and request helpers shared by the Netlify
+// functions.
+package httpx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// JSONErrorResponse returns a response with the given status code and a body
+// of the form {"status": message}.
+func JSONErrorResponse(code int, message string) (*events.APIGatewayProxyResponse, error) {
+	return JSONResponse(code, map[string]string{"status": message})
+}
+
+// JSONResponse marshals v and returns it as the body of an application/json
+// response.
+func JSONResponse(code int, v any) (*events.APIGatewayProxyResponse, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			Body: `{"status": "Error marshaling JSON."}`,
+		}, nil
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: code,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: string(b),
+	}, nil
+}
+
+// ViolationsResponse lists every problem found with a payload, as
+// {"status": message, "errors": violations}.
+func ViolationsResponse(code int, message string, violations any) (*events.APIGatewayProxyResponse, error) {
+	return JSONResponse(code, struct {
+		Status string `json:"status"`
+		Errors any    `json:"errors"`
+	}{message, violations})
+}
+
+// GetCookie returns the value of the named cookie sent with the request.
+func GetCookie(request events.APIGatewayProxyRequest, name string) (string, error) {
+	header := http.Header{}
+	for k, v := range request.Headers {
+		if http.CanonicalHeaderKey(k) == "Cookie" {
+			header.Add("Cookie", v)
+		}
+	}
+	if len(header) == 0 {
+		for k, vs := range request.MultiValueHeaders {
+			if http.CanonicalHeaderKey(k) == "Cookie" {
+				header["Cookie"] = append(header["Cookie"], vs...)
+			}
+		}
+	}
+
+	r := http.Request{Header: header}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", errors.New("Failed to extract " + name + " from cookie.")
+	}
+
+	return cookie.Value, nil
+}
+
+// ClearCookie returns a set-cookie value that expires the named cookie.
+func ClearCookie(name string) string {
+	return name + "=;Path=/;HttpOnly;Secure;SameSite=strict;expires=Thu, 01 Jan 1970 00:00:00 GMT;"
+}
+
+// ErrBodyTooLarge is returned by ReadBody when the body exceeds the limit.
+var ErrBodyTooLarge = errors.New("Request body too large.")
+
+// ReadBody returns the request body, decoding it if Netlify delivered it
+// base64 encoded, and fails with ErrBodyTooLarge if it is over maxBytes.
+func ReadBody(request events.APIGatewayProxyRequest, maxBytes int) ([]byte, error) {
+	if !request.IsBase64Encoded {
+		if len(request.Body) > maxBytes {
+			return nil, ErrBodyTooLarge
+		}
+		return []byte(request.Body), nil
+	}
+
+	if base64.StdEncoding.DecodedLen(len(request.Body)) > maxBytes+2 {
+		return nil, ErrBodyTooLarge
+	}
+	b, err := base64.StdEncoding.DecodeString(request.Body)
+	if err != nil {
+		return nil, errors.New("Malformed base64 body.")
+	}
+	if len(b) > maxBytes {
+		return nil, ErrBodyTooLarge
+	}
+	return b, nil
+}
+
+// Header returns the named request header, ignoring the case of its name.
+func Header(request events.APIGatewayProxyRequest, name string) string {
+	name = http.CanonicalHeaderKey(name)
+	for k, v := range request.Headers {
+		if http.CanonicalHeaderKey(k) == name {
+			return v
+		}
+	}
+	for k, vs := range request.MultiValueHeaders {
+		if http.CanonicalHeaderKey(k) == name && len(vs) > 0 {
+			return vs[0]
+		}
+	}
+	return ""
+}
+
+// Expands reports whether the comma separated ?expand= parameter lists the
+// given field.
+func Expands(request events.APIGatewayProxyRequest, field string) bool {
+	for _, v := range strings.Split(request.QueryStringParameters["expand"], ",") {
+		if strings.TrimSpace(v) == field {
+			return true
+		}
+	}
+	return false
+}
+
+// IsJSON reports whether the request declares an application/json body.
+func IsJSON(request events.APIGatewayProxyRequest) bool {
+	mediaType, _, err := mime.ParseMediaType(Header(request, "Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// PreconditionFailedResponse reports a stale If-Match, telling the client
+// the version it conflicted with. etag may be empty if nothing exists yet.
+func PreconditionFailedResponse(message string, version int64, etag string) (*events.APIGatewayProxyResponse, error) {
+	response, err := JSONResponse(http.StatusPreconditionFailed, struct {
+		Status  string `json:"status"`
+		Version int64  `json:"version"`
+	}{message, version})
+	if etag != "" {
+		response.Headers["ETag"] = etag
+	}
+	return response, err
+}
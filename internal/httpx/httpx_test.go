@@ -0,0 +1,73 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestReadBody(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+
+	tests := []struct {
+		name    string
+		request events.APIGatewayProxyRequest
+		want    string
+		tooLong bool
+	}{
+		{name: "plain", request: events.APIGatewayProxyRequest{Body: `{"a":1}`}, want: `{"a":1}`},
+		{name: "plain at the limit", request: events.APIGatewayProxyRequest{Body: "12345678"}, want: "12345678"},
+		{name: "plain over the limit", request: events.APIGatewayProxyRequest{Body: "123456789"}, tooLong: true},
+		{name: "base64", request: events.APIGatewayProxyRequest{Body: b64([]byte(`{"a":1}`)), IsBase64Encoded: true}, want: `{"a":1}`},
+		// 8 bytes encode to 12 characters, of which DecodedLen counts 9
+		{name: "base64 at the limit", request: events.APIGatewayProxyRequest{Body: b64([]byte("12345678")), IsBase64Encoded: true}, want: "12345678"},
+		{name: "base64 over the limit", request: events.APIGatewayProxyRequest{Body: b64([]byte("123456789")), IsBase64Encoded: true}, tooLong: true},
+		{name: "base64 far over the limit", request: events.APIGatewayProxyRequest{Body: b64(bytes.Repeat([]byte("a"), 100)), IsBase64Encoded: true}, tooLong: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ReadBody(tt.request, 8)
+			if tt.tooLong {
+				if !errors.Is(err, ErrBodyTooLarge) {
+					t.Fatalf("err = %v, want ErrBodyTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("body = %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBodyMalformedBase64(t *testing.T) {
+	_, err := ReadBody(events.APIGatewayProxyRequest{Body: "not base64!", IsBase64Encoded: true}, 100)
+	if err == nil || errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("err = %v, want a malformed body error", err)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	request := events.APIGatewayProxyRequest{
+		Headers:           map[string]string{"content-type": "application/json"},
+		MultiValueHeaders: map[string][]string{"If-Match": {`"1"`, `"2"`}, "X-Empty": {}},
+	}
+
+	for name, want := range map[string]string{
+		"Content-Type": "application/json",
+		"CONTENT-TYPE": "application/json",
+		"if-match":     `"1"`,
+		"X-Empty":      "",
+		"Missing":      "",
+	} {
+		if got := Header(request, name); got != want {
+			t.Errorf("Header(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package notices queues messages for users that are delivered on their
+// next visit, e.g. that a pinned repo was deleted.
+package notices
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+)
+
+// Notice is a single message. Data depends on Kind.
+type Notice struct {
+	ID        string         `json:"id"`
+	Kind      string         `json:"kind"`
+	Data      map[string]any `json:"data"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// Add queues a notice for the user.
+func Add(ctx context.Context, conn db.Querier, userID int, kind string, data map[string]any) error {
+	_, err := conn.Exec(ctx, `INSERT INTO notices (user_id, kind, data) VALUES ($1, $2, $3);`, userID, kind, data)
+	return err
+}
+
+// Take returns the user's undelivered notices, oldest first, and marks them
+// delivered.
+func Take(ctx context.Context, conn db.Querier, userID int) ([]Notice, error) {
+	rows, err := conn.Query(ctx, `UPDATE notices SET delivered_at = now()
+		WHERE user_id = $1 AND delivered_at IS NULL
+		RETURNING id::STRING, kind, data, created_at;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taken := []Notice{}
+	for rows.Next() {
+		var n Notice
+		err := rows.Scan(&n.ID, &n.Kind, &n.Data, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		taken = append(taken, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING has no ORDER BY
+	sort.Slice(taken, func(i, j int) bool {
+		return taken[i].CreatedAt.Before(taken[j].CreatedAt)
+	})
+	return taken, nil
+}
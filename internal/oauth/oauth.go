@@ -0,0 +1,100 @@
+// Package oauth holds the GitHub OAuth configuration and the state/PKCE
+// helpers shared by the redirect and callback functions.
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+const (
+	// StateCookieName holds the state sent to GitHub in the redirect.
+	StateCookieName = "state"
+	// VerifierCookieName holds the PKCE code_verifier for the pending login.
+	VerifierCookieName = "pkce"
+
+	// cookieMaxAge bounds how long a login may sit on GitHub's consent page.
+	cookieMaxAge = 600
+)
+
+var githubOauthConfig *oauth2.Config
+
+func init() {
+	githubOauthConfig = &oauth2.Config{
+		RedirectURL:  os.Getenv("GITHUB_CALLBACK"),
+		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
+		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+		Endpoint:     github.Endpoint,
+		// read:org lets org bulletins check the user's membership and role
+		Scopes: []string{"read:org"},
+	}
+}
+
+// Config returns the GitHub OAuth configuration.
+func Config() *oauth2.Config {
+	return githubOauthConfig
+}
+
+const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890-"
+
+// GenerateState returns a random string of the given length.
+func GenerateState(length int) string {
+	ll := len(chars)
+	b := make([]byte, length)
+	rand.Read(b) // generates len(b) random bytes
+
+	for i := 0; i < length; i++ {
+		b[i] = chars[int(b[i])%ll]
+	}
+	return string(b)
+}
+
+// ValidState reports whether the state returned by GitHub matches the one
+// stored in the cookie.
+func ValidState(stored, returned string) bool {
+	if stored == "" || returned == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(returned)) == 1
+}
+
+// GenerateVerifier returns a PKCE code_verifier as described in RFC 7636.
+func GenerateVerifier() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ChallengeOption adds the S256 code_challenge for verifier to an auth URL.
+func ChallengeOption(verifier string) []oauth2.AuthCodeOption {
+	sum := sha256.Sum256([]byte(verifier))
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+}
+
+// VerifierOption sends verifier along with the token exchange.
+func VerifierOption(verifier string) oauth2.AuthCodeOption {
+	return oauth2.SetAuthURLParam("code_verifier", verifier)
+}
+
+// SetCookie returns a set-cookie value for one of the short lived login
+// cookies. SameSite must be lax: the callback is a cross-site navigation from
+// github.com, and strict cookies would never be sent with it.
+func SetCookie(name, value string) string {
+	return fmt.Sprintf(`%s=%s;Path=/;HttpOnly;Secure;SameSite=lax;max-age=%d`, name, value, cookieMaxAge)
+}
+
+// ClearCookie returns a set-cookie value that expires one of the login
+// cookies.
+func ClearCookie(name string) string {
+	return name + "=;Path=/;HttpOnly;Secure;SameSite=lax;expires=Thu, 01 Jan 1970 00:00:00 GMT;"
+}
@@ -0,0 +1,287 @@
+// Package repocache caches GitHub repository metadata in the repos table so
+// that bulletins can be hydrated, and saves validated, without spending
+// GitHub rate limit on every request.
+package repocache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+)
+
+const (
+	// TTL is how long a cached copy is served before it is revalidated.
+	TTL = 6 * time.Hour
+
+	// maxConcurrentFetches bounds parallel requests to GitHub.
+	maxConcurrentFetches = 8
+)
+
+// Metadata is what a bulletin shows for a pinned repository.
+type Metadata struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	FullName    string   `json:"fullName"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Language    string   `json:"language"`
+	Topics      []string `json:"topics"`
+	Stars       int      `json:"stars"`
+	Forks       int      `json:"forks"`
+	Owner       string   `json:"owner"`
+	OwnerID     int      `json:"ownerId"`
+}
+
+// FromGitHub converts a GitHub API repository to cached metadata.
+func FromGitHub(r *github.Repo) *Metadata {
+	topics := r.Topics
+	if topics == nil {
+		topics = []string{}
+	}
+	return &Metadata{
+		ID:          r.ID,
+		Name:        r.Name,
+		FullName:    r.FullName,
+		Description: r.Description,
+		URL:         r.HTMLURL,
+		Language:    r.Language,
+		Topics:      topics,
+		Stars:       r.StargazersCount,
+		Forks:       r.ForksCount,
+		Owner:       r.Owner.Login,
+		OwnerID:     r.Owner.ID,
+	}
+}
+
+type entry struct {
+	meta      *Metadata
+	etag      string
+	fetchedAt time.Time
+}
+
+// Lookup returns metadata for the given repository IDs. Fresh copies come
+// from the cache; missing or stale ones are (re)fetched with client using
+// conditional requests and written back. If a refetch fails, a stale copy is
+// still returned, unless GitHub answered that the repo is gone or private,
+// in which case it is evicted. IDs GitHub cannot resolve are absent from
+// the result.
+func Lookup(ctx context.Context, conn db.Querier, client *github.Client, ids []int) (map[int]*Metadata, error) {
+	found, err := read(ctx, conn, `SELECT id, data, COALESCE(etag, ''), fetched_at FROM repos WHERE id = ANY($1);`, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]*Metadata, len(ids))
+	var stale []entry
+	for _, id := range ids {
+		e, ok := found[id]
+		if ok {
+			result[id] = e.meta
+		}
+		if !ok {
+			stale = append(stale, entry{meta: &Metadata{ID: id}})
+		} else if time.Since(e.fetchedAt) > TTL {
+			stale = append(stale, e)
+		}
+	}
+
+	for _, r := range revalidate(ctx, client, stale) {
+		if r.gone {
+			delete(result, r.meta.ID)
+			err := Evict(ctx, conn, r.meta.ID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if r.err != nil {
+			continue
+		}
+		result[r.meta.ID] = r.meta
+		err := write(ctx, conn, r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Cached returns whatever the cache holds for the given IDs, however old.
+func Cached(ctx context.Context, conn db.Querier, ids []int) (map[int]*Metadata, error) {
+	found, err := read(ctx, conn, `SELECT id, data, COALESCE(etag, ''), fetched_at FROM repos WHERE id = ANY($1);`, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]*Metadata, len(found))
+	for id, e := range found {
+		result[id] = e.meta
+	}
+	return result, nil
+}
+
+// Fresh returns the cached metadata of the given IDs that is within its TTL,
+// without calling GitHub.
+func Fresh(ctx context.Context, conn db.Querier, ids []int) (map[int]*Metadata, error) {
+	found, err := read(ctx, conn, `SELECT id, data, COALESCE(etag, ''), fetched_at FROM repos
+		WHERE id = ANY($1) AND fetched_at > $2;`, ids, time.Now().Add(-TTL))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]*Metadata, len(found))
+	for id, e := range found {
+		result[id] = e.meta
+	}
+	return result, nil
+}
+
+// Store writes metadata to the cache, e.g. after a listing already returned
+// full repository objects. Listings carry no per-repo ETag, so the next
+// refresh of the entry is unconditional.
+func Store(ctx context.Context, conn db.Querier, meta *Metadata) error {
+	return write(ctx, conn, result{meta: meta, changed: true})
+}
+
+// Evict removes the given IDs from the cache, e.g. once their repos were
+// found deleted or private, so their metadata is no longer served.
+func Evict(ctx context.Context, conn db.Querier, ids ...int) error {
+	_, err := conn.Exec(ctx, `DELETE FROM repos WHERE id = ANY($1);`, ids)
+	return err
+}
+
+// Stats summarizes a Refresh run.
+type Stats struct {
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+	Evicted   int `json:"evicted"`
+	Failed    int `json:"failed"`
+}
+
+// Refresh revalidates up to limit of the least recently fetched entries
+// past half their TTL. It is meant for a scheduled function, keeping the
+// cache warm so page views rarely have to wait on GitHub. Repos that are
+// gone or private are evicted, and entries that fail otherwise still have
+// their fetched_at bumped, so that they do not crowd out the rest on the
+// next run.
+func Refresh(ctx context.Context, conn db.Querier, client *github.Client, limit int) (Stats, error) {
+	var stats Stats
+
+	found, err := read(ctx, conn, `SELECT id, data, COALESCE(etag, ''), fetched_at FROM repos
+		WHERE fetched_at < $1 ORDER BY fetched_at LIMIT $2;`, time.Now().Add(-TTL/2), limit)
+	if err != nil {
+		return stats, err
+	}
+
+	stale := make([]entry, 0, len(found))
+	for _, e := range found {
+		stale = append(stale, e)
+	}
+
+	for _, r := range revalidate(ctx, client, stale) {
+		switch {
+		case r.gone:
+			stats.Evicted++
+			err := Evict(ctx, conn, r.meta.ID)
+			if err != nil {
+				return stats, err
+			}
+			continue
+		case r.err != nil:
+			stats.Failed++
+			r = result{meta: r.meta}
+		case r.changed:
+			stats.Changed++
+		default:
+			stats.Unchanged++
+		}
+
+		err := write(ctx, conn, r)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// result is the outcome of revalidating an entry. gone means GitHub
+// answered that the repo does not exist or is private.
+type result struct {
+	meta    *Metadata
+	etag    string
+	changed bool
+	gone    bool
+	err     error
+}
+
+func read(ctx context.Context, conn db.Querier, sql string, args ...any) (map[int]entry, error) {
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[int]entry{}
+	for rows.Next() {
+		var id int
+		e := entry{meta: &Metadata{}}
+		err := rows.Scan(&id, e.meta, &e.etag, &e.fetchedAt)
+		if err != nil {
+			return nil, err
+		}
+		found[id] = e
+	}
+	return found, rows.Err()
+}
+
+// write stores a revalidated entry. Unchanged entries only have their
+// fetched_at bumped.
+func write(ctx context.Context, conn db.Querier, r result) error {
+	if !r.changed {
+		_, err := conn.Exec(ctx, `UPDATE repos SET fetched_at = now() WHERE id = $1;`, r.meta.ID)
+		return err
+	}
+
+	_, err := conn.Exec(ctx, `UPSERT INTO repos (id, data, etag, owner_id, fetched_at) VALUES ($1, $2, NULLIF($3, ''), $4, now());`,
+		r.meta.ID, r.meta, r.etag, r.meta.OwnerID)
+	return err
+}
+
+// revalidate requests the given entries from GitHub in parallel, sending
+// their ETags so unchanged repos come back as cheap 304s.
+func revalidate(ctx context.Context, client *github.Client, entries []entry) []result {
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxConcurrentFetches)
+		results = make([]result, len(entries))
+	)
+
+	for i, e := range entries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, e entry) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			repo, etag, err := client.RepoIfNoneMatch(ctx, e.meta.ID, e.etag)
+			switch {
+			case github.IsNotFound(err), repo != nil && repo.Private:
+				results[i] = result{meta: e.meta, gone: true}
+			case err != nil:
+				results[i] = result{meta: e.meta, err: err}
+			case repo == nil:
+				results[i] = result{meta: e.meta, etag: etag}
+			default:
+				results[i] = result{meta: FromGitHub(repo), etag: etag, changed: true}
+			}
+		}(i, e)
+	}
+	wg.Wait()
+
+	return results
+}
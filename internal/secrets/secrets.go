@@ -0,0 +1,218 @@
+// Package secrets encrypts values such as GitHub access tokens before they
+// are stored in the database.
+//
+// Values are envelope encrypted: each value gets its own random data key,
+// which is sealed with AES-GCM under a versioned key encryption key from
+// TOKEN_ENCRYPTION_KEYS. A stored value looks like
+//
+//	enc:<version>:<base64 sealed data key>:<base64 sealed value>
+//
+// Values without the enc: prefix predate encryption and are returned as is,
+// so rows can be migrated gradually.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const prefix = "enc:"
+
+type kek struct {
+	version string
+	aead    cipher.AEAD
+}
+
+type keyring struct {
+	keys    []kek
+	version map[string]cipher.AEAD
+}
+
+var (
+	ringOnce sync.Once
+	ring     *keyring
+	ringErr  error
+)
+
+// loadKeyring parses TOKEN_ENCRYPTION_KEYS, a comma separated list of
+// version:key entries, newest first. Each key is 32 base64 encoded bytes.
+func loadKeyring() (*keyring, error) {
+	ringOnce.Do(func() {
+		ring, ringErr = parseKeyring(os.Getenv("TOKEN_ENCRYPTION_KEYS"))
+	})
+	return ring, ringErr
+}
+
+func parseKeyring(keys string) (*keyring, error) {
+	kr := &keyring{version: map[string]cipher.AEAD{}}
+
+	for _, entry := range strings.Split(keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		version, material, ok := strings.Cut(entry, ":")
+		if !ok || version == "" {
+			return nil, errors.New("Malformed TOKEN_ENCRYPTION_KEYS entry.")
+		}
+		if _, ok := kr.version[version]; ok {
+			return nil, fmt.Errorf("Duplicate encryption key version %q.", version)
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(material)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("Encryption key %q must be 32 base64 encoded bytes.", version)
+		}
+
+		aead, err := newAEAD(raw)
+		if err != nil {
+			return nil, err
+		}
+		kr.keys = append(kr.keys, kek{version: version, aead: aead})
+		kr.version[version] = aead
+	}
+
+	if len(kr.keys) == 0 {
+		return nil, errors.New("No token encryption keys configured.")
+	}
+	return kr, nil
+}
+
+// Encrypt seals plaintext under the newest key. associated is bound to the
+// ciphertext (e.g. the owning user's ID), so a value copied to another row
+// fails to decrypt.
+func Encrypt(plaintext, associated string) (string, error) {
+	kr, err := loadKeyring()
+	if err != nil {
+		return "", err
+	}
+	current := kr.keys[0]
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealedKey, err := seal(current.aead, dataKey, []byte(current.version))
+	if err != nil {
+		return "", err
+	}
+	sealedValue, err := seal(dataAEAD, []byte(plaintext), []byte(associated))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + current.version + ":" +
+		base64.StdEncoding.EncodeToString(sealedKey) + ":" +
+		base64.StdEncoding.EncodeToString(sealedValue), nil
+}
+
+// Decrypt opens a value produced by Encrypt with the same associated data.
+// Values that were never encrypted are returned unchanged.
+func Decrypt(stored, associated string) (string, error) {
+	if !IsEncrypted(stored) {
+		return stored, nil
+	}
+
+	kr, err := loadKeyring()
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(strings.TrimPrefix(stored, prefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("Malformed encrypted value.")
+	}
+	version := parts[0]
+
+	kekAEAD, ok := kr.version[version]
+	if !ok {
+		return "", fmt.Errorf("Unknown encryption key version %q.", version)
+	}
+
+	sealedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("Malformed encrypted value.")
+	}
+	sealedValue, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("Malformed encrypted value.")
+	}
+
+	dataKey, err := open(kekAEAD, sealedKey, []byte(version))
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, sealedValue, []byte(associated))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether stored was produced by Encrypt.
+func IsEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, prefix)
+}
+
+// NeedsRotation reports whether stored is plaintext or sealed under a key
+// other than the newest one.
+func NeedsRotation(stored string) (bool, error) {
+	if !IsEncrypted(stored) {
+		return true, nil
+	}
+
+	kr, err := loadKeyring()
+	if err != nil {
+		return false, err
+	}
+
+	version, _, _ := strings.Cut(strings.TrimPrefix(stored, prefix), ":")
+	return version != kr.keys[0].version, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce || ciphertext.
+func seal(aead cipher.AEAD, plaintext, associated []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, associated), nil
+}
+
+func open(aead cipher.AEAD, sealed, associated []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("Malformed encrypted value.")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, associated)
+	if err != nil {
+		return nil, errors.New("Failed to decrypt value.")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,10 @@
+-- One row per issued JWT, keyed by its jti claim. A token is only accepted
+-- while its session exists, is unexpired and has not been revoked.
+CREATE TABLE IF NOT EXISTS sessions (
+	jti STRING PRIMARY KEY,
+	user_id INT8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ,
+	INDEX sessions_user_id_idx (user_id)
+);
@@ -0,0 +1,3 @@
+-- Incremented by every save; exposed as the bulletin's ETag so that saves
+-- can be made conditional with If-Match.
+ALTER TABLE bulletins ADD COLUMN IF NOT EXISTS version INT8 NOT NULL DEFAULT 1;
@@ -0,0 +1,11 @@
+-- Every save appends the saved document here. Rows beyond
+-- BULLETIN_MAX_REVISIONS per user are pruned by the save that exceeds it.
+CREATE TABLE IF NOT EXISTS bulletin_revisions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id INT8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	version INT8 NOT NULL,
+	data JSONB NOT NULL,
+	session_id STRING,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	INDEX bulletin_revisions_user_id_version_idx (user_id, version DESC)
+);
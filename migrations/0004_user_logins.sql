@@ -0,0 +1,13 @@
+-- GitHub logins, so public pages can be looked up by /{login}. Logins are
+-- unique ignoring case, like on GitHub.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS login STRING;
+CREATE UNIQUE INDEX IF NOT EXISTS users_lower_login_idx ON users (lower(login));
+
+-- Logins a user was previously known by, lowercased, so old URLs keep
+-- working after a GitHub rename.
+CREATE TABLE IF NOT EXISTS login_aliases (
+	login STRING PRIMARY KEY,
+	user_id INT8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	renamed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	INDEX login_aliases_user_id_idx (user_id)
+);
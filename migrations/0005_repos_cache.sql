@@ -0,0 +1,7 @@
+-- Cached GitHub repository metadata keyed by repository ID, so bulletin
+-- pages can be hydrated without a GitHub request per visitor.
+CREATE TABLE IF NOT EXISTS repos (
+	id INT8 PRIMARY KEY,
+	data JSONB NOT NULL,
+	fetched_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
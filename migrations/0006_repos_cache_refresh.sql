@@ -0,0 +1,5 @@
+-- etag enables conditional refreshes that cost no rate limit when a repo is
+-- unchanged; owner_id lets saves check ownership without calling GitHub.
+ALTER TABLE repos ADD COLUMN IF NOT EXISTS etag STRING;
+ALTER TABLE repos ADD COLUMN IF NOT EXISTS owner_id INT8;
+CREATE INDEX IF NOT EXISTS repos_fetched_at_idx ON repos (fetched_at);
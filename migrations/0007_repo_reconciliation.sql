@@ -0,0 +1,20 @@
+-- reconciled_at is when the reconcile-bulletins job last checked a
+-- bulletin's pinned repos; it visits the least recently checked first.
+ALTER TABLE bulletins ADD COLUMN IF NOT EXISTS reconciled_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS bulletins_reconciled_at_idx ON bulletins (reconciled_at);
+
+-- Opt-in removal of pinned repos that were deleted, made private or
+-- transferred away, as found by the reconcile-bulletins job.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS prune_missing_repos BOOL NOT NULL DEFAULT false;
+
+-- Messages for a user, returned once by the account function on their next
+-- visit and then marked delivered.
+CREATE TABLE IF NOT EXISTS notices (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id INT8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	kind STRING NOT NULL,
+	data JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	delivered_at TIMESTAMPTZ,
+	INDEX notices_user_id_idx (user_id) WHERE delivered_at IS NULL
+);
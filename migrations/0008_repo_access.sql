@@ -0,0 +1,4 @@
+-- Which repos a user may pin: 'owned' (their own and their organizations'),
+-- 'affiliated' (also those they collaborate on) or 'contributed' (also
+-- those they contributed to).
+ALTER TABLE users ADD COLUMN IF NOT EXISTS repo_access STRING NOT NULL DEFAULT 'owned';
@@ -0,0 +1,13 @@
+-- Bulletins owned by a GitHub organization rather than a user. Any active
+-- member of the organization whose role is at least editor_role ('member'
+-- or 'admin') may save it; only admins may create it or change editor_role.
+CREATE TABLE IF NOT EXISTS org_bulletins (
+	org_id INT8 PRIMARY KEY,
+	login STRING NOT NULL,
+	data JSONB NOT NULL,
+	version INT8 NOT NULL DEFAULT 1,
+	editor_role STRING NOT NULL DEFAULT 'admin',
+	updated_by INT8 REFERENCES users (id) ON DELETE SET NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE INDEX org_bulletins_login_idx (lower(login))
+);
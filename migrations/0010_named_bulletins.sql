@@ -0,0 +1,14 @@
+-- A user may have several bulletins, each identified by a slug. Existing
+-- bulletins become the user's 'default' bulletin, served at /{login}.
+ALTER TABLE bulletins ADD COLUMN IF NOT EXISTS slug STRING NOT NULL DEFAULT 'default';
+ALTER TABLE bulletins ADD COLUMN IF NOT EXISTS title STRING NOT NULL DEFAULT '';
+ALTER TABLE bulletins ADD COLUMN IF NOT EXISTS visibility STRING NOT NULL DEFAULT 'public';
+ALTER TABLE bulletins ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE bulletins ALTER PRIMARY KEY USING COLUMNS (user_id, slug);
+-- ALTER PRIMARY KEY keeps the old primary key as a unique index, which
+-- would still allow only one bulletin per user.
+DROP INDEX IF EXISTS bulletins@bulletins_user_id_key CASCADE;
+
+ALTER TABLE bulletin_revisions ADD COLUMN IF NOT EXISTS slug STRING NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS bulletin_revisions_user_id_slug_version_idx ON bulletin_revisions (user_id, slug, version DESC);
+DROP INDEX IF EXISTS bulletin_revisions@bulletin_revisions_user_id_version_idx;
@@ -0,0 +1,9 @@
+-- Metadata of bulletin entries hosted outside GitHub, keyed by source
+-- ('gitlab', 'codeberg', 'npm', 'go') and the entry's path or name there.
+CREATE TABLE IF NOT EXISTS external_cache (
+	source STRING NOT NULL,
+	key STRING NOT NULL,
+	data JSONB NOT NULL,
+	fetched_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (source, key)
+);
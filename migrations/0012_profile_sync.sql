@@ -0,0 +1,17 @@
+-- Opt-in syncing of a user's default bulletin from .repo-bulletin.yml in
+-- their profile repository, {login}/{login}, by the sync-bulletins job.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS sync_from_profile BOOL NOT NULL DEFAULT false;
+
+-- The outcome of the last sync of each user who opted in. sha is the blob
+-- SHA of the file last synced successfully; the job skips a file until it
+-- changes. The job visits the least recently checked users first.
+CREATE TABLE IF NOT EXISTS profile_syncs (
+	user_id INT8 PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	status STRING NOT NULL,
+	message STRING NOT NULL DEFAULT '',
+	errors JSONB,
+	sha STRING NOT NULL DEFAULT '',
+	checked_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	synced_at TIMESTAMPTZ,
+	INDEX profile_syncs_checked_at_idx (checked_at)
+);
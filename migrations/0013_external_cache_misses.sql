@@ -0,0 +1,3 @@
+-- Entries a source answered as not found are cached too, with missing set
+-- and empty data, so that they are not refetched on every view.
+ALTER TABLE external_cache ADD COLUMN IF NOT EXISTS missing BOOL NOT NULL DEFAULT false;
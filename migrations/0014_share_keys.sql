@@ -0,0 +1,4 @@
+-- A per-bulletin secret that share tokens are bound to. A bulletin that is
+-- deleted and created again gets a new one, and renaming rotates it, so
+-- old tokens stop working for whatever bulletin later holds the slug.
+ALTER TABLE bulletins ADD COLUMN IF NOT EXISTS share_key STRING NOT NULL DEFAULT gen_random_uuid()::STRING;
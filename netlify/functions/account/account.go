@@ -1,157 +1,180 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"net/http"
-	"os"
-	"strconv"
-	"strings"
 
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/BoilingSoup/repo-bulletin/internal/notices"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/github"
 )
 
-type UserData struct {
-	ID          int    `json:"id"`
-	AccessToken string `json:"access_token"`
+func main() {
+	lambda.Start(auth.WithRefresh(handler))
 }
 
-var githubOauthConfig *oauth2.Config
+/*
+	GET   /account  the user, their settings and any notices not yet shown
+	PATCH /account  change settings, e.g. {"pruneMissingRepos": true}
 
-func init() {
-	githubOauthConfig = &oauth2.Config{
-		RedirectURL:  os.Getenv("GITHUB_CALLBACK"),
-		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
-		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
-		Endpoint:     github.Endpoint,
-	}
+	repoAccess is which repos the user may pin: "owned", "affiliated" or
+	"contributed"; see the bulletin package.
+
+	syncFromProfile keeps the default bulletin in sync with
+	.repo-bulletin.yml in the user's profile repository, {login}/{login}.
+	sync is the outcome of the last sync, or null before the first.
+*/
+
+// maxSettingsBytes caps the size of a settings change.
+const maxSettingsBytes = 4 << 10
+
+type Settings struct {
+	PruneMissingRepos bool   `json:"pruneMissingRepos"`
+	RepoAccess        string `json:"repoAccess"`
+	SyncFromProfile   bool   `json:"syncFromProfile"`
 }
 
-func main() {
-	lambda.Start(handler)
+// SettingsPatch is a settings change; absent fields are left as they are.
+type SettingsPatch struct {
+	PruneMissingRepos *bool   `json:"pruneMissingRepos"`
+	RepoAccess        *string `json:"repoAccess"`
+	SyncFromProfile   *bool   `json:"syncFromProfile"`
 }
 
-func jsonErrorResponse(code int, message string) (*events.APIGatewayProxyResponse, error) {
-	return &events.APIGatewayProxyResponse{
-		StatusCode: code,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: fmt.Sprintf(`{"status": "%s"}`, message),
-	}, nil
+type Account struct {
+	ID       int                  `json:"id"`
+	Name     string               `json:"name"`
+	Settings Settings             `json:"settings"`
+	Sync     *bulletin.SyncStatus `json:"sync"`
+	Notices  []notices.Notice     `json:"notices"`
 }
 
 func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
-	id, err := getUser(request)
-	if err != nil {
-		return jsonErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+	if request.HTTPMethod != http.MethodGet && request.HTTPMethod != http.MethodPatch {
+		return httpx.JSONErrorResponse(http.StatusMethodNotAllowed, "Method not allowed.")
 	}
 
-	config, err := pgx.ParseConfig(os.Getenv("COCKROACHDB_URL"))
+	conn, err := db.Connect(context.Background())
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to create DB config.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
 	}
+	defer conn.Close(context.Background())
 
-	conn, err := pgx.ConnectConfig(context.Background(), config)
+	id, err := auth.GetUser(context.Background(), conn, request)
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to connect to DB.")
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
 	}
-	defer conn.Close(context.Background())
 
-	row := conn.QueryRow(context.Background(), `SELECT id, access_token FROM users WHERE id = $1;`, id)
-	dst := UserData{}
-	err = row.Scan(&dst.ID, &dst.AccessToken)
+	dst, err := db.FindUser(context.Background(), conn, id)
 	if err != pgx.ErrNoRows && err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
 	}
 	if err == pgx.ErrNoRows {
-		return jsonErrorResponse(http.StatusInternalServerError, "User does not exist in DB.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "User does not exist in DB.")
 	}
 
-	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/user", nil)
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to construct a request.")
+	if request.HTTPMethod == http.MethodPatch {
+		return updateSettings(conn, request, dst)
 	}
-	req.Header.Set("Authorization", "Bearer "+dst.AccessToken)
-	req.Header.Set("Accept", "application/vnd.github+json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	data, err := github.NewClient(dst.AccessToken).User(context.Background())
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to request user data.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Failed to request user data.")
 	}
-	defer resp.Body.Close()
 
-	var (
-		data struct {
-			Login string `json:"login"`
-		}
-	)
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to decode user data.")
+	if data.Login != dst.Login {
+		// the user was renamed on GitHub, or predates stored logins. This is
+		// best effort: the callback records it again on the next login.
+		db.ExecuteTx(context.Background(), conn, func(tx pgx.Tx) error {
+			return db.SetLogin(context.Background(), tx, id, data.Login)
+		})
 	}
 
-	return &events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: fmt.Sprintf(`{"id": %d, "name": "%s"}`, dst.ID, data.Login),
-	}, nil
-}
+	sync, err := bulletin.FindSyncStatus(context.Background(), conn, id)
+	if err != pgx.ErrNoRows && err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading sync status from DB.")
+	}
 
-func getUser(request events.APIGatewayProxyRequest) (int, error) {
-	tokenString, err := getJWTFromCookie(request)
+	pending, err := notices.Take(context.Background(), conn, id)
 	if err != nil {
-		return 0, err
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading notices from DB.")
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
+	return httpx.JSONResponse(http.StatusOK, Account{
+		ID:       dst.ID,
+		Name:     data.Login,
+		Settings: settingsOf(dst),
+		Sync:     sync,
+		Notices:  pending,
 	})
-	if err != nil {
-		return 0, err
-	}
+}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("Could not get jwt.MapClaims")
+// updateSettings applies a SettingsPatch and returns the resulting
+// settings.
+func updateSettings(conn *pgx.Conn, request events.APIGatewayProxyRequest, user *db.User) (*events.APIGatewayProxyResponse, error) {
+	if !httpx.IsJSON(request) {
+		return httpx.JSONErrorResponse(http.StatusUnsupportedMediaType, "Content-Type must be application/json.")
 	}
-
-	idString, ok := claims["id"].(string)
-	if !ok {
-		return 0, errors.New("Unexpected ID type.")
+	body, err := httpx.ReadBody(request, maxSettingsBytes)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
 	}
 
-	id, err := strconv.Atoi(idString)
+	var patch SettingsPatch
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&patch)
 	if err != nil {
-		return 0, err
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
 	}
-	return id, nil
-}
 
-const jwtCookieKey = "jwt="
+	if patch.RepoAccess != nil && !bulletin.ValidAccess(*patch.RepoAccess) {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Unknown repoAccess.")
+	}
 
-func getJWTFromCookie(request events.APIGatewayProxyRequest) (string, error) {
-	cookies := strings.Split(request.Headers["cookie"], "; ")
-	for _, v := range cookies {
-		if !strings.Contains(v, jwtCookieKey) {
-			continue
+	if patch.PruneMissingRepos != nil {
+		err := db.SetPruneMissingRepos(context.Background(), conn, user.ID, *patch.PruneMissingRepos)
+		if err != nil {
+			return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error saving settings in DB.")
 		}
-		return strings.Replace(v, jwtCookieKey, "", 1), nil
-
+		user.PruneMissingRepos = *patch.PruneMissingRepos
+	}
+	if patch.RepoAccess != nil {
+		err := db.SetRepoAccess(context.Background(), conn, user.ID, *patch.RepoAccess)
+		if err != nil {
+			return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error saving settings in DB.")
+		}
+		user.RepoAccess = *patch.RepoAccess
+	}
+	if patch.SyncFromProfile != nil && *patch.SyncFromProfile != user.SyncFromProfile {
+		err := db.ExecuteTx(context.Background(), conn, func(tx pgx.Tx) error {
+			err := db.SetSyncFromProfile(context.Background(), tx, user.ID, *patch.SyncFromProfile)
+			if err != nil {
+				return err
+			}
+			return bulletin.ResetSync(context.Background(), tx, user.ID)
+		})
+		if err != nil {
+			return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error saving settings in DB.")
+		}
+		user.SyncFromProfile = *patch.SyncFromProfile
 	}
 
-	return "", errors.New("Failed to extract JWT from cookie.")
+	return httpx.JSONResponse(http.StatusOK, settingsOf(user))
+}
+
+func settingsOf(user *db.User) Settings {
+	return Settings{
+		PruneMissingRepos: user.PruneMissingRepos,
+		RepoAccess:        user.RepoAccess,
+		SyncFromProfile:   user.SyncFromProfile,
+	}
 }
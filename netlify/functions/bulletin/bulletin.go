@@ -5,8 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/jackc/pgx/v5"
@@ -20,74 +26,81 @@ type UserData struct {
 	ID int `json:"id"`
 }
 
-type BulletinData struct {
-	Data map[string]any
-}
+/*
+	GET /bulletin?login=<login>&slug=<slug>  a bulletin; slug defaults to the one served at /{login}
+	GET /bulletin?login=<login>&list         the user's bulletins, without data
 
-func jsonErrorResponse(code int, message string) (*events.APIGatewayProxyResponse, error) {
-	return &events.APIGatewayProxyResponse{
-		StatusCode: code,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: fmt.Sprintf(`{"status": "%s"}`, message),
-	}, nil
-}
+	id=<GitHub user id> may be given instead of login. Listings leave out
+	unlisted and private bulletins unless the user asks for their own.
+
+	Private bulletins are only served to their owner, or with
+	&share=<token> from /share; to anyone else they do not exist. Neither
+	unlisted nor private bulletins are indexed.
+*/
 
 func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
-	id, ok := request.QueryStringParameters["id"]
-	if !ok {
-		return jsonErrorResponse(http.StatusBadRequest, "No id provided.")
-	}
-
-	// req, err := http.NewRequest(http.MethodGet, "https://api.github.com/users/"+user, nil)
-	// if err != nil {
-	// 	return jsonErrorResponse(http.StatusInternalServerError, "Failed to construct a request.")
-	// }
-	// req.Header.Set("Authorization", "Bearer "+os.Getenv("GITHUB_PAT"))
-	// req.Header.Set("Accept", "application/vnd.github+json")
-
-	// client := &http.Client{}
-	// resp, err := client.Do(req)
-	// if err != nil {
-	// 	return jsonErrorResponse(http.StatusInternalServerError, "Failed to request user data.")
-	// }
-	// defer resp.Body.Close()
-
-	// var data UserData
-	// err = json.NewDecoder(resp.Body).Decode(&data)
-	// if err != nil {
-	// 	return jsonErrorResponse(http.StatusInternalServerError, "Failed to decode user data.")
-	// }
-
-	config, err := pgx.ParseConfig(os.Getenv("COCKROACHDB_URL"))
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to create DB config.")
+	rawID, hasID := request.QueryStringParameters["id"]
+	login, hasLogin := request.QueryStringParameters["login"]
+	if !hasID && !hasLogin {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "No id or login provided.")
+	}
+
+	var id int
+	if !hasLogin {
+		var err error
+		id, err = strconv.Atoi(rawID)
+		if err != nil {
+			return httpx.JSONErrorResponse(http.StatusBadRequest, "Invalid id.")
+		}
 	}
 
-	conn, err := pgx.ConnectConfig(context.Background(), config)
+	conn, err := db.Connect(context.Background())
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to connect to DB.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
 	}
 	defer conn.Close(context.Background())
 
+	if hasLogin {
+		userID, current, err := db.ResolveLogin(context.Background(), conn, login)
+		if err != pgx.ErrNoRows && err != nil {
+			return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
+		}
+		if err == pgx.ErrNoRows {
+			return httpx.JSONErrorResponse(http.StatusNotFound, "User does not have an account.")
+		}
+		if !strings.EqualFold(current, login) {
+			return movedResponse(request, current)
+		}
+		id = userID
+	}
+
 	row := conn.QueryRow(context.Background(), `SELECT id FROM users WHERE id = $1;`, id)
 	ud := UserData{}
 	err = row.Scan(&ud.ID)
 	if err != pgx.ErrNoRows && err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
 	}
 	if err == pgx.ErrNoRows {
-		return jsonErrorResponse(http.StatusNotFound, "User does not have an account.")
+		return httpx.JSONErrorResponse(http.StatusNotFound, "User does not have an account.")
 	}
 
-	row = conn.QueryRow(context.Background(), `SELECT data FROM bulletins WHERE user_id = $1;`, id)
-	bd := BulletinData{}
-	err = row.Scan(&bd.Data)
+	if _, ok := request.QueryStringParameters["list"]; ok {
+		return listResponse(conn, request, ud.ID)
+	}
+
+	slug := request.QueryStringParameters["slug"]
+	if slug == "" {
+		slug = bulletin.DefaultSlug
+	}
+
+	bd, err := bulletin.Find(context.Background(), conn, ud.ID, slug)
 	if err != pgx.ErrNoRows && err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Error reading user bulletins from DB.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user bulletins from DB.")
 	}
 
+	if err == pgx.ErrNoRows && slug != bulletin.DefaultSlug {
+		return httpx.JSONErrorResponse(http.StatusNotFound, "Bulletin does not exist.")
+	}
 	if err == pgx.ErrNoRows {
 		return &events.APIGatewayProxyResponse{
 			StatusCode: 200,
@@ -98,16 +111,105 @@ func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResp
 		}, nil
 	}
 
+	if bd.Visibility == bulletin.VisibilityPrivate && !canReadPrivate(conn, request, ud.ID, bd) {
+		return httpx.JSONErrorResponse(http.StatusNotFound, "Bulletin does not exist.")
+	}
+
+	if httpx.Expands(request, "repos") {
+		response, err := expandedResponse(conn, bd.Data)
+		setVisibilityHeaders(response, bd.Visibility)
+		return response, err
+	}
+
+	etag := bulletin.ETag(bd.Version)
+	if httpx.Header(request, "If-None-Match") == etag {
+		response := &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotModified,
+			Headers: map[string]string{
+				"ETag": etag,
+			},
+		}
+		setVisibilityHeaders(response, bd.Visibility)
+		return response, nil
+	}
+
 	b, err := json.Marshal(bd.Data)
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Error marshaling JSON.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error marshaling JSON.")
 	}
 
-	return &events.APIGatewayProxyResponse{
+	response := &events.APIGatewayProxyResponse{
 		StatusCode: 200,
 		Headers: map[string]string{
 			"Content-Type": "application/json",
+			"ETag":         etag,
 		},
 		Body: fmt.Sprintf(`%s`, b),
-	}, nil
+	}
+	setVisibilityHeaders(response, bd.Visibility)
+	return response, nil
+}
+
+// canReadPrivate reports whether the request may read a private bulletin:
+// it is the owner's own, or carries a share token signed with the
+// bulletin's current share key.
+func canReadPrivate(conn *pgx.Conn, request events.APIGatewayProxyRequest, userID int, bd *bulletin.Stored) bool {
+	if token := request.QueryStringParameters["share"]; token != "" {
+		return auth.CheckShareToken(token, userID, bd.Slug, bd.ShareKey)
+	}
+	requester, err := auth.GetUser(context.Background(), conn, request)
+	return err == nil && requester == userID
+}
+
+// setVisibilityHeaders keeps bulletins that are not public out of search
+// engines, and private ones out of shared caches.
+func setVisibilityHeaders(response *events.APIGatewayProxyResponse, visibility string) {
+	if visibility == bulletin.VisibilityPublic {
+		return
+	}
+	response.Headers["X-Robots-Tag"] = "noindex"
+	if visibility == bulletin.VisibilityPrivate {
+		response.Headers["Cache-Control"] = "private, no-store"
+	}
+}
+
+// listResponse lists the user's bulletins; unlisted and private ones only
+// if the request is the user's own.
+func listResponse(conn *pgx.Conn, request events.APIGatewayProxyRequest, userID int) (*events.APIGatewayProxyResponse, error) {
+	requester, err := auth.GetUser(context.Background(), conn, request)
+	own := err == nil && requester == userID
+
+	infos, err := bulletin.List(context.Background(), conn, userID, own)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user bulletins from DB.")
+	}
+	return httpx.JSONResponse(http.StatusOK, infos)
+}
+
+// expandedResponse returns the bulletin with each repo resolved to its
+// metadata from the cache. It has no ETag, since the metadata can change
+// without the bulletin's version changing.
+func expandedResponse(conn *pgx.Conn, data bulletin.Payload) (*events.APIGatewayProxyResponse, error) {
+	expanded, err := bulletin.Expand(context.Background(), conn, data)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading repo metadata.")
+	}
+
+	return httpx.JSONResponse(http.StatusOK, expanded)
+}
+
+// movedResponse redirects a lookup by a login the user has since renamed
+// away from to their current login, keeping the rest of the query.
+func movedResponse(request events.APIGatewayProxyRequest, login string) (*events.APIGatewayProxyResponse, error) {
+	response, err := httpx.JSONResponse(http.StatusMovedPermanently, struct {
+		Status string `json:"status"`
+		Login  string `json:"login"`
+	}{"User was renamed.", login})
+	query := url.Values{}
+	for k, v := range request.QueryStringParameters {
+		query.Set(k, v)
+	}
+	query.Set("login", login)
+	response.Headers["Location"] = request.Path + "?" + query.Encode()
+	return response, err
 }
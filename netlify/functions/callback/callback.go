@@ -2,173 +2,111 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
-	"fmt"
 	"net/http"
-	"os"
-	"strings"
 
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/BoilingSoup/repo-bulletin/internal/oauth"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/github"
 )
 
-var githubOauthConfig *oauth2.Config
-
-func init() {
-	githubOauthConfig = &oauth2.Config{
-		RedirectURL:  os.Getenv("GITHUB_CALLBACK"),
-		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
-		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
-		Endpoint:     github.Endpoint,
-	}
-}
-
 func main() {
 	lambda.Start(handler)
 }
 
-type UserData struct {
-	ID          int    `json:"id"`
-	Login       string `json:"login"`
-	accessToken string // no export; assign manually
-
-}
-
-func jsonErrorResponse(code int, message string) (*events.APIGatewayProxyResponse, error) {
-	return &events.APIGatewayProxyResponse{
-		StatusCode: code,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: fmt.Sprintf(`{"status": "%s"}`, message),
-	}, nil
-}
-
 func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
-	// validState := validateState(request)
-	// if !validState {
-	// 	return jsonErrorResponse(http.StatusUnauthorized, "Invalid state.")
-	// }
-
-	code := request.QueryStringParameters["code"]
-	token, err := githubOauthConfig.Exchange(oauth2.NoContext, code)
-	if err != nil {
-		return jsonErrorResponse(http.StatusBadRequest, "Could not get token.")
+	if !validateState(request) {
+		return loginErrorResponse("invalid_state")
 	}
 
-	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/user", nil)
+	verifier, err := httpx.GetCookie(request, oauth.VerifierCookieName)
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to construct a request.")
+		return loginErrorResponse("invalid_state")
 	}
-	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
-	req.Header.Set("Accept", "application/vnd.github+json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to request user data.")
+	if _, ok := request.QueryStringParameters["error"]; ok {
+		// e.g. the user clicked "Cancel" on GitHub's consent page
+		return loginErrorResponse("access_denied")
 	}
-	defer resp.Body.Close()
 
-	// io.Copy(os.Stdout, resp.Body)
-	var data UserData
-	err = json.NewDecoder(resp.Body).Decode(&data)
+	code := request.QueryStringParameters["code"]
+	token, err := oauth.Config().Exchange(context.Background(), code, oauth.VerifierOption(verifier))
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to decode user data.")
+		return loginErrorResponse("exchange_failed")
 	}
 
-	config, err := pgx.ParseConfig(os.Getenv("COCKROACHDB_URL"))
+	data, err := github.NewClient(token.AccessToken).User(context.Background())
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to create DB config.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Failed to request user data.")
 	}
 
-	conn, err := pgx.ConnectConfig(context.Background(), config)
+	conn, err := db.Connect(context.Background())
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to connect to DB.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
 	}
 	defer conn.Close(context.Background())
 
-	row := conn.QueryRow(context.Background(), `SELECT id FROM users WHERE id = $1;`, data.ID)
-	dst := UserData{}
-	err = row.Scan(&dst.ID)
-	switch {
-	case err != pgx.ErrNoRows && err != nil:
-		return jsonErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
-
-	case err == pgx.ErrNoRows:
-		_, err = conn.Exec(context.Background(), `INSERT INTO users (id, access_token) VALUES ($1, $2);`, data.ID, token.AccessToken)
+	err = db.ExecuteTx(context.Background(), conn, func(tx pgx.Tx) error {
+		err := db.SaveUser(context.Background(), tx, data.ID, token.AccessToken)
 		if err != nil {
-			return jsonErrorResponse(http.StatusInternalServerError, "Error creating user in DB.")
-		}
-
-	case err == nil:
-		_, err = conn.Exec(context.Background(), `UPDATE users SET access_token = $1 WHERE id = $2;`, token.AccessToken, data.ID)
-		if err != nil {
-			return jsonErrorResponse(http.StatusInternalServerError, "Error updating user in DB.")
+			return err
 		}
+		return db.SetLogin(context.Background(), tx, data.ID, data.Login)
+	})
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error saving user in DB.")
 	}
 
-	jwt, err := generateJWT(data.ID)
+	jwt, err := auth.GenerateJWT(context.Background(), conn, data.ID)
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Error creating JWT token.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error creating JWT token.")
 	}
 
 	return &events.APIGatewayProxyResponse{
 		StatusCode: http.StatusTemporaryRedirect,
 		Headers: map[string]string{
-			"Location":   "https://repobullet.in/" + data.Login,
-			"set-cookie": fmt.Sprintf(`jwt=%s;Path=/;HttpOnly;Secure;SameSite=strict;max-age=86400`, jwt),
+			"Location": "https://repobullet.in/" + data.Login,
+		},
+		MultiValueHeaders: map[string][]string{
+			"set-cookie": append(clearLoginCookies(), auth.SetCookie(jwt)),
 		},
 		Body: `{"status": "success"}`,
 	}, nil
 }
 
-func validateState(request events.APIGatewayProxyRequest) bool {
-	storedState, err := getStateFromCookie(request)
-	if err != nil {
-		return false
-	}
-
-	paramState := request.QueryStringParameters["state"]
-	if storedState != paramState {
-		return false
-	}
-
-	return true
+// loginErrorResponse sends the browser back to the home page with the reason
+// the login failed. The login cookies are cleared so a retry starts fresh.
+func loginErrorResponse(reason string) (*events.APIGatewayProxyResponse, error) {
+	return &events.APIGatewayProxyResponse{
+		StatusCode: http.StatusTemporaryRedirect,
+		Headers: map[string]string{
+			"Location": "https://repobullet.in/?login_error=" + reason,
+		},
+		MultiValueHeaders: map[string][]string{
+			"set-cookie": clearLoginCookies(),
+		},
+	}, nil
 }
 
-const stateCookieKey = "state="
-
-func getStateFromCookie(request events.APIGatewayProxyRequest) (string, error) {
-	cookies := strings.Split(request.Headers["cookie"], "; ")
-	for _, v := range cookies {
-		if !strings.Contains(v, stateCookieKey) {
-			continue
-		}
-
-		return strings.Replace(v, stateCookieKey, "", 1), nil
-
+// clearLoginCookies expires the state and PKCE cookies; each is good for a
+// single callback whether or not it succeeds.
+func clearLoginCookies() []string {
+	return []string{
+		oauth.ClearCookie(oauth.StateCookieName),
+		oauth.ClearCookie(oauth.VerifierCookieName),
 	}
-
-	return "", errors.New("Failed to retrieve state from cookie.")
 }
 
-var secret = []byte(os.Getenv("JWT_SECRET"))
-
-func generateJWT(id int) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["id"] = fmt.Sprint(id)
-
-	tokenString, err := token.SignedString(secret)
+func validateState(request events.APIGatewayProxyRequest) bool {
+	storedState, err := httpx.GetCookie(request, oauth.StateCookieName)
 	if err != nil {
-		return "", err
+		return false
 	}
 
-	return tokenString, nil
+	paramState := request.QueryStringParameters["state"]
+	return oauth.ValidState(storedState, paramState)
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/jackc/pgx/v5"
+)
+
+func main() {
+	lambda.Start(auth.WithRefresh(handler))
+}
+
+/*
+	GET /export?slug=<slug>&format=json|yaml  one of the user's bulletins, for /import
+
+	slug defaults to the bulletin served at /{login} and format to json.
+	GitHub repos are named by their full name besides their ID.
+*/
+
+var contentTypes = map[string]string{
+	bulletin.FormatJSON: "application/json",
+	bulletin.FormatYAML: "application/yaml",
+}
+
+func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != http.MethodGet {
+		return httpx.JSONErrorResponse(http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+
+	format := request.QueryStringParameters["format"]
+	if format == "" {
+		format = bulletin.FormatJSON
+	}
+	contentType, ok := contentTypes[format]
+	if !ok {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Format must be json or yaml.")
+	}
+
+	slug := request.QueryStringParameters["slug"]
+	if slug == "" {
+		slug = bulletin.DefaultSlug
+	}
+	if !bulletin.ValidSlug(slug) {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Invalid slug.")
+	}
+
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	id, err := auth.GetUser(context.Background(), conn, request)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+	}
+
+	stored, err := bulletin.Find(context.Background(), conn, id, slug)
+	if err != pgx.ErrNoRows && err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user bulletins from DB.")
+	}
+	if err == pgx.ErrNoRows {
+		return httpx.JSONErrorResponse(http.StatusNotFound, "Bulletin does not exist.")
+	}
+
+	export, err := bulletin.NewExport(context.Background(), conn, stored)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading repo metadata.")
+	}
+	b, err := export.Marshal(format)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error encoding bulletin.")
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"Content-Type":        contentType,
+			"Content-Disposition": fmt.Sprintf(`attachment; filename="%s.bulletin.%s"`, slug, format),
+		},
+		Body: string(b),
+	}, nil
+}
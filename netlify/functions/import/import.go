@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/jackc/pgx/v5"
+)
+
+func main() {
+	lambda.Start(auth.WithRefresh(handler))
+}
+
+/*
+	POST|PUT /import?slug=<slug>  save a bulletin from an /export, creating it if the slug is new
+
+	The body is JSON or YAML, told apart by its Content-Type. GitHub repos
+	named by their full name are resolved to their current ID. The bulletin
+	goes through the same checks as a save, and takes the export's title and
+	visibility if it has them.
+*/
+
+// maxImportBytes caps the size of an import. It is larger than a save's
+// limit, as exports repeat every repo's name and YAML indents deeply.
+const maxImportBytes = 512 << 10
+
+// formats maps the accepted content types to their format.
+var formats = map[string]string{
+	"application/json":   bulletin.FormatJSON,
+	"application/yaml":   bulletin.FormatYAML,
+	"application/x-yaml": bulletin.FormatYAML,
+	"text/yaml":          bulletin.FormatYAML,
+}
+
+func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != http.MethodPost && request.HTTPMethod != http.MethodPut {
+		return httpx.JSONErrorResponse(http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	session, err := auth.GetSession(context.Background(), conn, request)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+	}
+	id, err := session.UserID()
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+	}
+
+	slug := request.QueryStringParameters["slug"]
+	if slug == "" {
+		slug = bulletin.DefaultSlug
+	}
+	if !bulletin.ValidSlug(slug) {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Invalid slug.")
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(httpx.Header(request, "Content-Type"))
+	format, ok := formats[mediaType]
+	if !ok {
+		return httpx.JSONErrorResponse(http.StatusUnsupportedMediaType, "Content-Type must be application/json or application/yaml.")
+	}
+
+	payload, err := httpx.ReadBody(request, maxImportBytes)
+	if errors.Is(err, httpx.ErrBodyTooLarge) {
+		return httpx.JSONErrorResponse(http.StatusRequestEntityTooLarge, "Payload too large.")
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
+	}
+	if len(payload) == 0 {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "No data provided.")
+	}
+
+	export, violations := bulletin.DecodeExport(payload, format)
+	if violations == nil {
+		info := export.Info()
+		violations = info.Validate()
+	}
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusBadRequest, "Bad payload.", violations)
+	}
+
+	user, err := db.FindUser(context.Background(), conn, id)
+	if err != pgx.ErrNoRows && err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
+	}
+	if err == pgx.ErrNoRows {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "User does not exist in DB.")
+	}
+
+	violations, err = export.ResolveRepos(context.Background(), user)
+	if err == bulletin.ErrGitHub {
+		return httpx.JSONErrorResponse(http.StatusBadGateway, err.Error())
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error resolving repos.")
+	}
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusUnprocessableEntity, "Unknown repos in payload.", violations)
+	}
+
+	data := export.Payload()
+	violations = data.Validate()
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusBadRequest, "Bad payload.", violations)
+	}
+	data.ClearStatuses()
+
+	violations, err = bulletin.CheckRepoAccess(context.Background(), conn, user, data)
+	if err == bulletin.ErrGitHub {
+		return httpx.JSONErrorResponse(http.StatusBadGateway, err.Error())
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error checking repos.")
+	}
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusUnprocessableEntity, "Unauthorized repos in payload.", violations)
+	}
+
+	violations, err = bulletin.CheckGistAccess(context.Background(), conn, user, data)
+	if err == bulletin.ErrGitHub {
+		return httpx.JSONErrorResponse(http.StatusBadGateway, "Failed to request user gists.")
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error checking gists.")
+	}
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusUnprocessableEntity, "Unauthorized gists in payload.", violations)
+	}
+
+	version, err := bulletin.Save(context.Background(), conn, id, slug, session.ID, data, export.Info(), httpx.Header(request, "If-Match"))
+	var conflict *bulletin.VersionConflict
+	if errors.As(err, &conflict) {
+		return httpx.PreconditionFailedResponse("Bulletin was changed by another save.", conflict.Current, bulletin.ETag(conflict.Current))
+	}
+	if err == bulletin.ErrTooManyBulletins {
+		return httpx.JSONErrorResponse(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error saving bulletin in DB.")
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 204,
+		Headers: map[string]string{
+			"ETag": bulletin.ETag(version),
+		},
+	}, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != http.MethodPost {
+		return httpx.JSONErrorResponse(http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	id, err := auth.GetUser(context.Background(), conn, request)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+	}
+
+	err = auth.RevokeAll(context.Background(), conn, id)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error while revoking sessions.")
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 204,
+		Headers: map[string]string{
+			"set-cookie": auth.ClearCookie(),
+		},
+	}, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 )
@@ -19,10 +22,26 @@ func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResp
 		}, nil
 	}
 
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	// an invalid or already revoked token has nothing left to revoke; the
+	// cookie is cleared either way
+	claims, err := auth.GetSession(context.Background(), conn, request)
+	if err == nil {
+		err = auth.Revoke(context.Background(), conn, claims.ID)
+		if err != nil {
+			return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error while revoking session.")
+		}
+	}
+
 	return &events.APIGatewayProxyResponse{
 		StatusCode: 204,
 		Headers: map[string]string{
-			"set-cookie": fmt.Sprintf(`jwt=;Path=/;HttpOnly;Secure;SameSite=strict;expires=Thu, 01 Jan 1970 00:00:00 GMT;`),
+			"set-cookie": auth.ClearCookie(),
 		},
 		Body: `{"status": "success"}`,
 	}, nil
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/jackc/pgx/v5"
+)
+
+func main() {
+	lambda.Start(auth.WithRefresh(handler))
+}
+
+/*
+	GET   /org-bulletin?org=<login>  the organization's bulletin; ?expand=repos as for /bulletin
+	PUT   /org-bulletin?org=<login>  save it, as a member with at least its editor role
+	PATCH /org-bulletin?org=<login>  {"editorRole": "member" | "admin"}, as an admin
+
+	Only admins may create an organization's bulletin. Membership is checked
+	with GitHub on every write, using the user's access token.
+*/
+
+const (
+	// maxPayloadBytes caps the size of a saved bulletin.
+	maxPayloadBytes = 256 << 10
+
+	// maxSettingsBytes caps the size of a settings change.
+	maxSettingsBytes = 4 << 10
+)
+
+type OrgSettings struct {
+	EditorRole string `json:"editorRole"`
+}
+
+func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	org := request.QueryStringParameters["org"]
+	if org == "" {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "No org provided.")
+	}
+
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	switch request.HTTPMethod {
+	case http.MethodGet:
+		return get(conn, request, org)
+	case http.MethodPost, http.MethodPut:
+		return save(conn, request, org)
+	case http.MethodPatch:
+		return updateSettings(conn, request, org)
+	}
+	return httpx.JSONErrorResponse(http.StatusMethodNotAllowed, "Method not allowed.")
+}
+
+func get(conn *pgx.Conn, request events.APIGatewayProxyRequest, org string) (*events.APIGatewayProxyResponse, error) {
+	ob, err := bulletin.FindOrg(context.Background(), conn, org)
+	if err != pgx.ErrNoRows && err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading org bulletin from DB.")
+	}
+	if err == pgx.ErrNoRows {
+		return httpx.JSONErrorResponse(http.StatusNotFound, "Organization does not have a bulletin.")
+	}
+
+	if httpx.Expands(request, "repos") {
+		expanded, err := bulletin.Expand(context.Background(), conn, ob.Data)
+		if err != nil {
+			return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading repo metadata.")
+		}
+		return httpx.JSONResponse(http.StatusOK, expanded)
+	}
+
+	etag := bulletin.ETag(ob.Version)
+	if httpx.Header(request, "If-None-Match") == etag {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotModified,
+			Headers: map[string]string{
+				"ETag": etag,
+			},
+		}, nil
+	}
+
+	response, err := httpx.JSONResponse(http.StatusOK, ob.Data)
+	response.Headers["ETag"] = etag
+	return response, err
+}
+
+func save(conn *pgx.Conn, request events.APIGatewayProxyRequest, org string) (*events.APIGatewayProxyResponse, error) {
+	user, membership, errResponse := authorize(conn, request, org)
+	if errResponse != nil {
+		return errResponse, nil
+	}
+
+	editorRole := bulletin.RoleAdmin
+	ob, err := bulletin.FindOrgByID(context.Background(), conn, membership.Organization.ID)
+	if err != pgx.ErrNoRows && err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading org bulletin from DB.")
+	}
+	if err == nil {
+		editorRole = ob.EditorRole
+	}
+	if !bulletin.CanEdit(membership, editorRole) {
+		return httpx.JSONErrorResponse(http.StatusForbidden, "Role may not edit the organization's bulletin.")
+	}
+
+	if !httpx.IsJSON(request) {
+		return httpx.JSONErrorResponse(http.StatusUnsupportedMediaType, "Content-Type must be application/json.")
+	}
+	payload, err := httpx.ReadBody(request, maxPayloadBytes)
+	if errors.Is(err, httpx.ErrBodyTooLarge) {
+		return httpx.JSONErrorResponse(http.StatusRequestEntityTooLarge, "Payload too large.")
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
+	}
+	if len(payload) == 0 {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "No data provided.")
+	}
+
+	data, violations := bulletin.Decode(payload)
+	if violations == nil {
+		violations = data.Validate()
+	}
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusBadRequest, "Bad payload.", violations)
+	}
+	data.ClearStatuses()
+
+	client := github.NewClient(user.AccessToken)
+	violations, err = bulletin.CheckOrgRepoAccess(context.Background(), conn, client, membership.Organization, data)
+	if err == bulletin.ErrGitHub {
+		return httpx.JSONErrorResponse(http.StatusBadGateway, err.Error())
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error checking repos.")
+	}
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusUnprocessableEntity, "Unauthorized repos in payload.", violations)
+	}
+
+	version, err := bulletin.SaveOrg(context.Background(), conn, membership.Organization, user.ID, data, httpx.Header(request, "If-Match"))
+	var conflict *bulletin.VersionConflict
+	if errors.As(err, &conflict) {
+		return httpx.PreconditionFailedResponse("Bulletin was changed by another save.", conflict.Current, bulletin.ETag(conflict.Current))
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error saving bulletin in DB.")
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 204,
+		Headers: map[string]string{
+			"ETag": bulletin.ETag(version),
+		},
+	}, nil
+}
+
+func updateSettings(conn *pgx.Conn, request events.APIGatewayProxyRequest, org string) (*events.APIGatewayProxyResponse, error) {
+	_, membership, errResponse := authorize(conn, request, org)
+	if errResponse != nil {
+		return errResponse, nil
+	}
+	if !bulletin.CanEdit(membership, bulletin.RoleAdmin) {
+		return httpx.JSONErrorResponse(http.StatusForbidden, "Only organization admins may change settings.")
+	}
+
+	ob, err := bulletin.FindOrgByID(context.Background(), conn, membership.Organization.ID)
+	if err != pgx.ErrNoRows && err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading org bulletin from DB.")
+	}
+	if err == pgx.ErrNoRows {
+		return httpx.JSONErrorResponse(http.StatusNotFound, "Organization does not have a bulletin.")
+	}
+
+	if !httpx.IsJSON(request) {
+		return httpx.JSONErrorResponse(http.StatusUnsupportedMediaType, "Content-Type must be application/json.")
+	}
+	body, err := httpx.ReadBody(request, maxSettingsBytes)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
+	}
+
+	var settings OrgSettings
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&settings)
+	if err != nil || !bulletin.ValidRole(settings.EditorRole) {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
+	}
+
+	err = bulletin.SetOrgEditorRole(context.Background(), conn, ob.OrgID, settings.EditorRole)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error saving settings in DB.")
+	}
+	return httpx.JSONResponse(http.StatusOK, settings)
+}
+
+// authorize authenticates the request and asks GitHub for the user's
+// membership in the organization. It returns a response to send instead if
+// either fails.
+func authorize(conn *pgx.Conn, request events.APIGatewayProxyRequest, org string) (*db.User, *github.Membership, *events.APIGatewayProxyResponse) {
+	id, err := auth.GetUser(context.Background(), conn, request)
+	if err != nil {
+		response, _ := httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+		return nil, nil, response
+	}
+
+	user, err := db.FindUser(context.Background(), conn, id)
+	if err != pgx.ErrNoRows && err != nil {
+		response, _ := httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
+		return nil, nil, response
+	}
+	if err == pgx.ErrNoRows {
+		response, _ := httpx.JSONErrorResponse(http.StatusInternalServerError, "User does not exist in DB.")
+		return nil, nil, response
+	}
+
+	membership, err := github.NewClient(user.AccessToken).Membership(context.Background(), org)
+	var statusErr *github.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusForbidden {
+		// tokens from before org bulletins lack read:org; logging in again
+		// grants it
+		response, _ := httpx.JSONErrorResponse(http.StatusForbidden, "Log in again to grant access to organization membership.")
+		return nil, nil, response
+	}
+	if github.IsNotFound(err) {
+		response, _ := httpx.JSONErrorResponse(http.StatusForbidden, "Not a member of the organization.")
+		return nil, nil, response
+	}
+	if err != nil {
+		response, _ := httpx.JSONErrorResponse(http.StatusBadGateway, "Failed to request organization membership.")
+		return nil, nil, response
+	}
+
+	return user, membership, nil
+}
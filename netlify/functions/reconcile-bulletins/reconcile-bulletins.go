@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// batchSize is how many bulletins one run reconciles. Runs are hourly (see
+// netlify.toml), so every bulletin is visited about once a day as long as
+// there are fewer than 24 * batchSize of them.
+const batchSize = 50
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	stats, err := bulletin.Reconcile(context.Background(), conn, batchSize)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reconciling bulletins.")
+	}
+	log.Printf("reconciled bulletins: %+v", stats)
+
+	return httpx.JSONResponse(http.StatusOK, stats)
+}
@@ -1,54 +1,32 @@
 package main
 
 import (
-	"crypto/rand"
-	"fmt"
 	"net/http"
-	"os"
 
+	"github.com/BoilingSoup/repo-bulletin/internal/oauth"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/github"
 )
 
-var githubOauthConfig *oauth2.Config
-
-func init() {
-	githubOauthConfig = &oauth2.Config{
-		RedirectURL:  os.Getenv("GITHUB_CALLBACK"),
-		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
-		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
-		Endpoint:     github.Endpoint,
-	}
-}
-
 func main() {
 	lambda.Start(handler)
 }
 
 func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
-	state := generateState(24)
-	url := githubOauthConfig.AuthCodeURL(state)
+	state := oauth.GenerateState(24)
+	verifier := oauth.GenerateVerifier()
+	url := oauth.Config().AuthCodeURL(state, oauth.ChallengeOption(verifier)...)
 
 	return &events.APIGatewayProxyResponse{
 		StatusCode: http.StatusTemporaryRedirect,
 		Headers: map[string]string{
-			"Location":   url,
-			"set-cookie": fmt.Sprintf(`state=%s;Path=/;HttpOnly;Secure;SameSite=strict;max-age=6000`, state),
+			"Location": url,
+		},
+		MultiValueHeaders: map[string][]string{
+			"set-cookie": {
+				oauth.SetCookie(oauth.StateCookieName, state),
+				oauth.SetCookie(oauth.VerifierCookieName, verifier),
+			},
 		},
 	}, nil
 }
-
-const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890-"
-
-func generateState(length int) string {
-	ll := len(chars)
-	b := make([]byte, length)
-	rand.Read(b) // generates len(b) random bytes
-
-	for i := 0; i < length; i++ {
-		b[i] = chars[int(b[i])%ll]
-	}
-	return string(b)
-}
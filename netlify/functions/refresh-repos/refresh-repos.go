@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/github"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/BoilingSoup/repo-bulletin/internal/repocache"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// batchSize is how many cached repos one run revalidates. Runs are hourly
+// (see netlify.toml) and must finish within the function timeout.
+const batchSize = 500
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	stats, err := repocache.Refresh(context.Background(), conn, github.NewAppClient(), batchSize)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error refreshing repo cache.")
+	}
+	log.Printf("refreshed repo cache: %+v", stats)
+
+	return httpx.JSONResponse(http.StatusOK, stats)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/jackc/pgx/v5"
+)
+
+func main() {
+	lambda.Start(auth.WithRefresh(handler))
+}
+
+/*
+	GET  /revisions?slug=<slug>      list a bulletin's revisions, newest first
+	GET  /revisions?id=<rev>         fetch a revision with its data
+	GET  /revisions?from=<a>&to=<b>  diff two revisions
+	POST /revisions?id=<rev>         restore a revision as a new save, checked like /save
+
+	slug defaults to the user's default bulletin. Revisions are found by id
+	alone and restore to the bulletin they were saved to.
+*/
+
+func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	session, err := auth.GetSession(context.Background(), conn, request)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+	}
+	id, err := session.UserID()
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+	}
+
+	params := request.QueryStringParameters
+	switch {
+	case request.HTTPMethod == http.MethodPost:
+		return restore(conn, request, id, session.ID, params["id"])
+
+	case request.HTTPMethod != http.MethodGet:
+		return httpx.JSONErrorResponse(http.StatusMethodNotAllowed, "Method not allowed.")
+
+	case params["from"] != "" || params["to"] != "":
+		return diff(conn, id, params["from"], params["to"])
+
+	case params["id"] != "":
+		revision, errResponse := getRevision(conn, id, params["id"])
+		if errResponse != nil {
+			return errResponse, nil
+		}
+		return httpx.JSONResponse(http.StatusOK, revision)
+	}
+
+	slug := params["slug"]
+	if slug == "" {
+		slug = bulletin.DefaultSlug
+	}
+	revisions, err := bulletin.ListRevisions(context.Background(), conn, id, slug)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading revisions from DB.")
+	}
+	return httpx.JSONResponse(http.StatusOK, revisions)
+}
+
+func diff(conn *pgx.Conn, userID int, fromID, toID string) (*events.APIGatewayProxyResponse, error) {
+	from, errResponse := getRevision(conn, userID, fromID)
+	if errResponse != nil {
+		return errResponse, nil
+	}
+	to, errResponse := getRevision(conn, userID, toID)
+	if errResponse != nil {
+		return errResponse, nil
+	}
+
+	return httpx.JSONResponse(http.StatusOK, struct {
+		From    string            `json:"from"`
+		To      string            `json:"to"`
+		Changes []bulletin.Change `json:"changes"`
+	}{from.ID, to.ID, bulletin.Diff(*from.Data, *to.Data)})
+}
+
+func restore(conn *pgx.Conn, request events.APIGatewayProxyRequest, userID int, sessionID, revisionID string) (*events.APIGatewayProxyResponse, error) {
+	revision, errResponse := getRevision(conn, userID, revisionID)
+	if errResponse != nil {
+		return errResponse, nil
+	}
+
+	// the revision goes through the checks of a save, as the user may have
+	// lost access to some of its repos since
+	data := *revision.Data
+	data.ClearStatuses()
+	if violations := data.Validate(); len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusUnprocessableEntity, "Invalid revision.", violations)
+	}
+
+	user, err := db.FindUser(context.Background(), conn, userID)
+	if err != pgx.ErrNoRows && err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
+	}
+	if err == pgx.ErrNoRows {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "User does not exist in DB.")
+	}
+
+	violations, err := bulletin.CheckRepoAccess(context.Background(), conn, user, data)
+	if err == bulletin.ErrGitHub {
+		return httpx.JSONErrorResponse(http.StatusBadGateway, err.Error())
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error checking repos.")
+	}
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusUnprocessableEntity, "Unauthorized repos in revision.", violations)
+	}
+
+	violations, err = bulletin.CheckGistAccess(context.Background(), conn, user, data)
+	if err == bulletin.ErrGitHub {
+		return httpx.JSONErrorResponse(http.StatusBadGateway, "Failed to request user gists.")
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error checking gists.")
+	}
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusUnprocessableEntity, "Unauthorized gists in revision.", violations)
+	}
+
+	version, err := bulletin.Save(context.Background(), conn, userID, revision.Slug, sessionID, data, bulletin.InfoUpdate{}, httpx.Header(request, "If-Match"))
+	var conflict *bulletin.VersionConflict
+	if errors.As(err, &conflict) {
+		return httpx.PreconditionFailedResponse("Bulletin was changed by another save.", conflict.Current, bulletin.ETag(conflict.Current))
+	}
+	if err == bulletin.ErrTooManyBulletins {
+		return httpx.JSONErrorResponse(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error restoring revision in DB.")
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: 204,
+		Headers: map[string]string{
+			"ETag": bulletin.ETag(version),
+		},
+	}, nil
+}
+
+// getRevision loads one of the user's revisions, or returns the error
+// response to send instead.
+func getRevision(conn *pgx.Conn, userID int, revisionID string) (*bulletin.Revision, *events.APIGatewayProxyResponse) {
+	if !bulletin.ValidRevisionID(revisionID) {
+		response, _ := httpx.JSONErrorResponse(http.StatusBadRequest, "Invalid revision id.")
+		return nil, response
+	}
+
+	revision, err := bulletin.GetRevision(context.Background(), conn, userID, revisionID)
+	if err == pgx.ErrNoRows {
+		response, _ := httpx.JSONErrorResponse(http.StatusNotFound, "Revision does not exist.")
+		return nil, response
+	}
+	if err != nil {
+		response, _ := httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading revision from DB.")
+		return nil, response
+	}
+
+	return revision, nil
+}
@@ -1,283 +1,220 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"net/url"
-	"os"
-	"strconv"
-	"strings"
 
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/golang-jwt/jwt"
 	"github.com/jackc/pgx/v5"
 )
 
 func main() {
-	lambda.Start(handler)
-}
-
-func jsonErrorResponse(code int, message string) (*events.APIGatewayProxyResponse, error) {
-	return &events.APIGatewayProxyResponse{
-		StatusCode: code,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: fmt.Sprintf(`{"status": "%s"}`, message),
-	}, nil
-}
-
-type Repo struct {
-	Id     string `json:"id"`
-	RepoID int    `json:"repoID"`
-}
-
-type Section struct {
-	Id    string `json:"id"`
-	Name  string `json:"name"`
-	Repos []Repo `json:"repos"`
-}
-
-type Payload struct {
-	Sections []Section `json:"sections"`
+	lambda.Start(auth.WithRefresh(handler))
 }
 
 /*
-	{
-	  sections: [
-	    {
-	      id: nanoid(),
-	      name: "my title blahblahblah",
-	      repos: [
-	        {
-	          id: nanoid(),
-	          repoID: number
-	        }
-	      ]
-	    }
-	  ]
-	}
+	POST|PUT /save?slug=<slug>  save a bulletin, creating it if the slug is new
+	PATCH    /save?slug=<slug>  {"slug", "title", "visibility"}, each optional
+	DELETE   /save?slug=<slug>  delete a bulletin with its revisions
+	GET      /save?x=<json>     deprecated form of POST
+
+	slug defaults to the bulletin served at /{login}.
 */
 
-type UserData struct {
-	ID          int    `json:"id"`
-	AccessToken string `json:"access_token"`
-}
+const (
+	// maxPayloadBytes caps the size of a saved bulletin.
+	maxPayloadBytes = 256 << 10
 
-type BulletinData struct {
-	Data Payload `json:"data"`
-}
+	// maxInfoBytes caps the size of a PATCH.
+	maxInfoBytes = 4 << 10
+)
 
 func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
-	id, err := getUser(request)
+	conn, err := db.Connect(context.Background())
 	if err != nil {
-		return jsonErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
 	}
+	defer conn.Close(context.Background())
 
-	payload, ok := request.QueryStringParameters["x"]
-	if !ok {
-		return jsonErrorResponse(http.StatusBadRequest, "No data provided.")
+	session, err := auth.GetSession(context.Background(), conn, request)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
 	}
-
-	payload, err = url.QueryUnescape(payload)
+	id, err := session.UserID()
 	if err != nil {
-		return jsonErrorResponse(http.StatusBadRequest, "Bad payload.")
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
 	}
 
-	var data Payload
-	json.Unmarshal([]byte(payload), &data)
-
-	if len(data.Sections) == 0 {
-		return jsonErrorResponse(http.StatusBadRequest, "Bad payload: No Sections")
+	slug := request.QueryStringParameters["slug"]
+	if slug == "" {
+		slug = bulletin.DefaultSlug
+	}
+	if !bulletin.ValidSlug(slug) {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Invalid slug.")
 	}
 
-	var sectionIDs = map[string]int{}
-	var repoUUIDs = map[string]int{}
-	for _, v := range data.Sections {
+	var payload []byte
+	var deprecated bool
+	switch request.HTTPMethod {
+	case http.MethodPost, http.MethodPut:
+		if !httpx.IsJSON(request) {
+			return httpx.JSONErrorResponse(http.StatusUnsupportedMediaType, "Content-Type must be application/json.")
+		}
 
-		if strings.Trim(v.Name, " ") == "" {
-			return jsonErrorResponse(http.StatusBadRequest, "Bad payload: Empty Section Name")
+		payload, err = httpx.ReadBody(request, maxPayloadBytes)
+		if errors.Is(err, httpx.ErrBodyTooLarge) {
+			return httpx.JSONErrorResponse(http.StatusRequestEntityTooLarge, "Payload too large.")
+		}
+		if err != nil {
+			return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
+		}
+		if len(payload) == 0 {
+			return httpx.JSONErrorResponse(http.StatusBadRequest, "No data provided.")
 		}
 
-		sectionIDs[v.Id]++
-		if sectionIDs[v.Id] != 1 {
-			return jsonErrorResponse(http.StatusBadRequest, "Bad payload: Duplicate Section IDs")
+	case http.MethodGet:
+		// Deprecated: the bulletin used to be sent as ?x=, which is capped by
+		// URL length limits and ends up in access logs. Kept for old clients.
+		x, ok := request.QueryStringParameters["x"]
+		if !ok {
+			return httpx.JSONErrorResponse(http.StatusBadRequest, "No data provided.")
 		}
 
-		if len(v.Repos) < 1 {
-			return jsonErrorResponse(http.StatusBadRequest, "Bad payload: Section without Repos")
+		x, err = url.QueryUnescape(x)
+		if err != nil {
+			return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
+		}
+		if len(x) > maxPayloadBytes {
+			return httpx.JSONErrorResponse(http.StatusRequestEntityTooLarge, "Payload too large.")
 		}
+		payload = []byte(x)
+		deprecated = true
 
-		var repoIDs = map[int]int{}
-		for _, repo := range v.Repos {
+	case http.MethodPatch:
+		return update(conn, request, id, slug)
 
-			repoUUIDs[repo.Id]++
-			repoIDs[repo.RepoID]++
+	case http.MethodDelete:
+		return remove(conn, id, slug)
 
-			if repo.RepoID == 0 {
-				return jsonErrorResponse(http.StatusBadRequest, "Bad payload: All Repos must have a repoID")
-			}
-			if repoUUIDs[repo.Id] != 1 {
-				return jsonErrorResponse(http.StatusBadRequest, "Bad payload: Duplicate Repo UUIDs")
-			}
-			if repoIDs[repo.RepoID] != 1 {
-				return jsonErrorResponse(http.StatusBadRequest, "Bad payload: A section can not have duplicate Repo IDs")
-			}
-		}
+	default:
+		return httpx.JSONErrorResponse(http.StatusMethodNotAllowed, "Method not allowed.")
 	}
 
-	config, err := pgx.ParseConfig(os.Getenv("COCKROACHDB_URL"))
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to create DB config.")
+	data, violations := bulletin.Decode(payload)
+	if violations == nil {
+		violations = data.Validate()
 	}
-
-	conn, err := pgx.ConnectConfig(context.Background(), config)
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to connect to DB.")
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusBadRequest, "Bad payload.", violations)
 	}
-	defer conn.Close(context.Background())
+	data.ClearStatuses()
 
-	row := conn.QueryRow(context.Background(), `SELECT id, access_token FROM users WHERE id = $1;`, id)
-	dst := UserData{}
-	err = row.Scan(&dst.ID, &dst.AccessToken)
+	dst, err := db.FindUser(context.Background(), conn, id)
 	if err != pgx.ErrNoRows && err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user from DB.")
 	}
 	if err == pgx.ErrNoRows {
-		return jsonErrorResponse(http.StatusInternalServerError, "User does not exist in DB.")
-	}
-
-	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/user", nil)
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to construct a request.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "User does not exist in DB.")
 	}
-	req.Header.Set("Authorization", "Bearer "+dst.AccessToken)
-	req.Header.Set("Accept", "application/vnd.github+json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to request user data.")
+	violations, err = bulletin.CheckRepoAccess(context.Background(), conn, dst, data)
+	if err == bulletin.ErrGitHub {
+		return httpx.JSONErrorResponse(http.StatusBadGateway, err.Error())
 	}
-	defer resp.Body.Close()
-
-	var (
-		userData struct {
-			Login string `json:"login"`
-		}
-	)
-	err = json.NewDecoder(resp.Body).Decode(&userData)
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to decode user data.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error checking repos.")
 	}
-
-	url := "https://api.github.com/users/" + userData.Login + "/repos"
-	req, err = http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to construct a request.")
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusUnprocessableEntity, "Unauthorized repos in payload.", violations)
 	}
-	req.Header.Set("Authorization", "Bearer "+dst.AccessToken)
-	req.Header.Set("Accept", "application/vnd.github+json")
 
-	client = &http.Client{}
-	resp, err = client.Do(req)
-	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to request user data.")
+	violations, err = bulletin.CheckGistAccess(context.Background(), conn, dst, data)
+	if err == bulletin.ErrGitHub {
+		return httpx.JSONErrorResponse(http.StatusBadGateway, "Failed to request user gists.")
 	}
-	defer resp.Body.Close()
-
-	var (
-		userRepos []struct {
-			ID int `json:"id"`
-		}
-	)
-	err = json.NewDecoder(resp.Body).Decode(&userRepos)
 	if err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Failed to decode user data.")
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error checking gists.")
 	}
-
-	validRepoIDs := make(map[int]bool, len(userRepos))
-	for _, v := range userRepos {
-		validRepoIDs[v.ID] = true
+	if len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusUnprocessableEntity, "Unauthorized gists in payload.", violations)
 	}
 
-	for _, v := range data.Sections {
-		for _, r := range v.Repos {
-			if _, ok := validRepoIDs[r.RepoID]; !ok {
-				return jsonErrorResponse(http.StatusUnprocessableEntity, "Unauthorized repos in payload.")
-			}
-		}
-	}
-
-	row = conn.QueryRow(context.Background(), `SELECT data FROM bulletins WHERE user_id = $1;`, dst.ID)
-	bd := BulletinData{}
-	err = row.Scan(&bd.Data)
-	if err != pgx.ErrNoRows && err != nil {
-		return jsonErrorResponse(http.StatusInternalServerError, "Error reading data from DB.")
+	version, err := bulletin.Save(context.Background(), conn, dst.ID, slug, session.ID, data, bulletin.InfoUpdate{}, httpx.Header(request, "If-Match"))
+	var conflict *bulletin.VersionConflict
+	if errors.As(err, &conflict) {
+		return httpx.PreconditionFailedResponse("Bulletin was changed by another save.", conflict.Current, bulletin.ETag(conflict.Current))
 	}
-	if err == pgx.ErrNoRows {
-		_, err = conn.Exec(context.Background(), `INSERT INTO bulletins (user_id, data) VALUES ($1, $2);`, dst.ID, data)
-		if err != nil {
-			return jsonErrorResponse(http.StatusInternalServerError, "Error creating bulletin in DB.")
-		}
+	if err == bulletin.ErrTooManyBulletins {
+		return httpx.JSONErrorResponse(http.StatusConflict, err.Error())
 	}
-	if err == nil {
-		_, err = conn.Exec(context.Background(), `UPDATE bulletins SET data = $1 WHERE user_id = $2`, data, dst.ID)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error saving bulletin in DB.")
 	}
 
-	return &events.APIGatewayProxyResponse{
+	response := &events.APIGatewayProxyResponse{
 		StatusCode: 204,
-	}, nil
+		Headers: map[string]string{
+			"ETag": bulletin.ETag(version),
+		},
+	}
+	if deprecated {
+		response.Headers["Deprecation"] = "true"
+	}
+	return response, nil
 }
 
-func getUser(request events.APIGatewayProxyRequest) (int, error) {
-	tokenString, err := getJWTFromCookie(request)
+// update renames a bulletin or changes its title or visibility, and
+// returns its resulting info.
+func update(conn *pgx.Conn, request events.APIGatewayProxyRequest, userID int, slug string) (*events.APIGatewayProxyResponse, error) {
+	if !httpx.IsJSON(request) {
+		return httpx.JSONErrorResponse(http.StatusUnsupportedMediaType, "Content-Type must be application/json.")
+	}
+	body, err := httpx.ReadBody(request, maxInfoBytes)
 	if err != nil {
-		return 0, err
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	var u bulletin.InfoUpdate
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&u)
 	if err != nil {
-		return 0, err
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Bad payload.")
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("Could not get jwt.MapClaims")
+	if violations := u.Validate(); len(violations) > 0 {
+		return httpx.ViolationsResponse(http.StatusBadRequest, "Bad payload.", violations)
 	}
 
-	idString, ok := claims["id"].(string)
-	if !ok {
-		return 0, errors.New("Unexpected ID type.")
+	info, err := bulletin.Update(context.Background(), conn, userID, slug, u)
+	if err == pgx.ErrNoRows {
+		return httpx.JSONErrorResponse(http.StatusNotFound, "Bulletin does not exist.")
+	}
+	if err == bulletin.ErrSlugTaken {
+		return httpx.JSONErrorResponse(http.StatusConflict, err.Error())
 	}
-
-	id, err := strconv.Atoi(idString)
 	if err != nil {
-		return 0, err
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error updating bulletin in DB.")
 	}
-	return id, nil
+	return httpx.JSONResponse(http.StatusOK, info)
 }
 
-const jwtCookieKey = "jwt="
-
-func getJWTFromCookie(request events.APIGatewayProxyRequest) (string, error) {
-	cookies := strings.Split(request.Headers["cookie"], "; ")
-	for _, v := range cookies {
-		if !strings.Contains(v, jwtCookieKey) {
-			continue
-		}
-		return strings.Replace(v, jwtCookieKey, "", 1), nil
-
+// remove deletes a bulletin along with its revisions.
+func remove(conn *pgx.Conn, userID int, slug string) (*events.APIGatewayProxyResponse, error) {
+	err := bulletin.Delete(context.Background(), conn, userID, slug)
+	if err == pgx.ErrNoRows {
+		return httpx.JSONErrorResponse(http.StatusNotFound, "Bulletin does not exist.")
 	}
-
-	return "", errors.New("Failed to extract JWT from cookie.")
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error deleting bulletin from DB.")
+	}
+	return &events.APIGatewayProxyResponse{StatusCode: 204}, nil
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/auth"
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/jackc/pgx/v5"
+)
+
+func main() {
+	lambda.Start(auth.WithRefresh(handler))
+}
+
+/*
+	POST /share?slug=<slug>&days=<n>  a share token for one of the user's bulletins
+
+	slug defaults to the bulletin served at /{login}. The token is valid for
+	days days, 7 by default and at most 30, and is passed to /bulletin as
+	&share=<token> to read the bulletin while it is private. Renaming or
+	deleting the bulletin invalidates its tokens, also for a bulletin later
+	given the same slug.
+*/
+
+const defaultShareDays = 7
+
+type Share struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != http.MethodPost {
+		return httpx.JSONErrorResponse(http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	id, err := auth.GetUser(context.Background(), conn, request)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusUnauthorized, "Unauthenticated")
+	}
+
+	slug := request.QueryStringParameters["slug"]
+	if slug == "" {
+		slug = bulletin.DefaultSlug
+	}
+	if !bulletin.ValidSlug(slug) {
+		return httpx.JSONErrorResponse(http.StatusBadRequest, "Invalid slug.")
+	}
+
+	ttl := defaultShareDays * 24 * time.Hour
+	if d, ok := request.QueryStringParameters["days"]; ok {
+		days, err := strconv.Atoi(d)
+		if err != nil || days < 1 || time.Duration(days)*24*time.Hour > auth.MaxShareTTL {
+			return httpx.JSONErrorResponse(http.StatusBadRequest, "Invalid days.")
+		}
+		ttl = time.Duration(days) * 24 * time.Hour
+	}
+
+	stored, err := bulletin.Find(context.Background(), conn, id, slug)
+	if err != pgx.ErrNoRows && err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error reading user bulletins from DB.")
+	}
+	if err == pgx.ErrNoRows {
+		return httpx.JSONErrorResponse(http.StatusNotFound, "Bulletin does not exist.")
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	token, err := auth.SignShareToken(id, slug, stored.ShareKey, expiresAt)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error signing share token.")
+	}
+	return httpx.JSONResponse(http.StatusOK, Share{Token: token, ExpiresAt: expiresAt})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/BoilingSoup/repo-bulletin/internal/bulletin"
+	"github.com/BoilingSoup/repo-bulletin/internal/db"
+	"github.com/BoilingSoup/repo-bulletin/internal/httpx"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// batchSize is how many users one run syncs. Runs are hourly (see
+// netlify.toml), so every opted in user is visited about once an hour as
+// long as there are fewer than batchSize of them, and less often beyond.
+const batchSize = 100
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	conn, err := db.Connect(context.Background())
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, err.Error())
+	}
+	defer conn.Close(context.Background())
+
+	stats, err := bulletin.Sync(context.Background(), conn, batchSize)
+	if err != nil {
+		return httpx.JSONErrorResponse(http.StatusInternalServerError, "Error syncing bulletins.")
+	}
+	log.Printf("synced bulletins: %+v", stats)
+
+	return httpx.JSONResponse(http.StatusOK, stats)
+}